@@ -2,14 +2,25 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
+	"scalpingbot/internal/breaker"
 	"scalpingbot/internal/buffer"
+	"scalpingbot/internal/fees"
+	"scalpingbot/internal/instance"
 	"scalpingbot/internal/listener"
 	"scalpingbot/internal/logger"
+	"scalpingbot/internal/outbox"
+	"scalpingbot/internal/reconcile"
 	"scalpingbot/internal/repository"
+	"scalpingbot/internal/risk"
+	"scalpingbot/internal/rules"
+	"scalpingbot/internal/schedule"
+	"scalpingbot/internal/sizing"
+	"scalpingbot/internal/takeprofit"
 	"scalpingbot/internal/tgbot"
 	"scalpingbot/internal/workers/profit_calc"
 	"syscall"
@@ -19,7 +30,14 @@ import (
 	"scalpingbot/internal/repo"
 	"scalpingbot/internal/worker"
 	"scalpingbot/internal/workers/buy_v1"
+	"scalpingbot/internal/workers/consolidate_v1"
+	"scalpingbot/internal/workers/dca_v1"
+	"scalpingbot/internal/workers/decay_v1"
+	"scalpingbot/internal/workers/grid_v1"
+	"scalpingbot/internal/workers/ladder_v1"
 	"scalpingbot/internal/workers/sell_v1"
+	"scalpingbot/internal/workers/stoploss_v1"
+	"scalpingbot/internal/workers/trailing_v1"
 	"time"
 )
 
@@ -37,22 +55,105 @@ func main() {
 	if err != nil {
 		log.Fatalf("Ошибка загрузки конфигурации: %v", err)
 	}
+	// Вторая копия бота на этой машине не запустится
+	instanceID := instance.NewID()
+	var previousInstanceID string
+	if cfg.Instance.Enabled {
+		instanceLock, err := instance.AcquireFileLock(cfg.Instance.LockFile, instanceID)
+		if err != nil {
+			log.Fatalf("Бот уже запущен: %v", err)
+		}
+		defer instanceLock.Release()
+		previousInstanceID = instanceLock.PreviousID()
+	}
 	// Создаём репозитории для хранения данных
 	storage := repo.NewSafeSet()
+	orders := repo.NewOrderStateStorage()
 	profitStorage := repo.NewSProfitStorage()
+	positions := repo.NewPositionStorage()
 
 	sqlLiteDb, err := repository.NewSQLiteUserRepository(cfg.DbPath)
 	if err != nil {
 		log.Fatalf("Ошибка создания SQLite репозитория: %v", err)
 	}
 
+	lots, err := repository.NewSQLiteLotRepository(sqlLiteDb.DB())
+	if err != nil {
+		log.Fatalf("Ошибка создания журнала позиций: %v", err)
+	}
+	outboxRepo, err := repository.NewSQLiteOutboxRepository(sqlLiteDb.DB())
+	if err != nil {
+		log.Fatalf("Ошибка создания журнала намерений: %v", err)
+	}
+
 	logLoger := logger.SetupLogger(cfg.TgToken, cfg.TgChatID)
 
 	// Создаём клиента MEXC и сторедж
-	ex := exchange.NewMEXCClient(cfg.APIKey, cfg.SecretKey, cfg.Symbol, logLoger)
+	client := exchange.NewMEXCClient(cfg.APIKey, cfg.SecretKey, cfg.Symbol, logLoger)
+	var ex exchange.Exchange = client
+	// Метка экземпляра на ордерах и поиск ордеров другой копии на бирже
+	var instanceMonitor *instance.Monitor
+	if cfg.Instance.Enabled {
+		instanceMonitor = instance.NewMonitor(cfg, ex, instanceID, previousInstanceID, logLoger)
+		other, err := instanceMonitor.CheckStartup(ctx)
+		if err != nil {
+			logLoger.Error(fmt.Sprintf("Ошибка проверки другого экземпляра бота: %v", err))
+		}
+		if other != "" {
+			log.Fatalf("На бирже есть свежие ордера другого экземпляра бота %s, запуск отменён", other)
+		}
+		ex = instance.NewGuard(ex, instanceMonitor)
+	}
+	// Все ордера воркеров и Telegram проходят через лимиты риска
+	if cfg.Risk.Enabled {
+		riskManager := risk.NewManager(cfg, ex, lots, logLoger)
+		ex = risk.NewGuard(ex, riskManager)
+	}
+	// Аварийный выключатель останавливает покупки при обвале
+	var circuitBreaker *breaker.Breaker
+	if cfg.CircuitBreaker.Enabled {
+		circuitBreaker = breaker.NewBreaker(cfg, ex, logLoger)
+		ex = breaker.NewGuard(ex, circuitBreaker)
+	}
+	var feeTracker *fees.Tracker
+	if cfg.Fees.Enabled {
+		feeTracker = fees.NewTracker(cfg, ex, lots)
+	}
+	sched, err := schedule.New(cfg)
+	if err != nil {
+		log.Fatalf("Ошибка загрузки расписания: %v", err)
+	}
+	// Ордера и отмены записываются до отправки на биржу
+	ob := outbox.New(cfg, ex, outboxRepo, instanceID)
+	placer := takeprofit.NewPlacer(cfg, ex, positions, orders, lots, feeTracker, sched, ob)
+
+	var entryFilter *rules.Filter
+	if cfg.EntryFilter.Enabled {
+		entryFilter, err = rules.NewFilter(cfg, ex)
+		if err != nil {
+			log.Fatalf("Ошибка разбора правил входа: %v", err)
+		}
+	}
+
+	// Доводим до конца ордера и отмены, прерванные падением прошлого запуска
+	replayer := outbox.NewReplayer(cfg, ex, outboxRepo, lots, placer, logLoger)
+	if err := replayer.Run(ctx); err != nil {
+		logLoger.Error(fmt.Sprintf("Ошибка разбора журнала намерений при старте: %v", err))
+	}
+
+	// Сверяем журнал с биржей, чтобы не потерять исполнения после перезапуска
+	if cfg.Reconcile.Enabled {
+		reconciler := reconcile.NewReconciler(cfg, ex, orders, positions, lots, placer, logLoger)
+		if _, err := reconciler.Run(ctx); err != nil {
+			logLoger.Error(fmt.Sprintf("Ошибка сверки при старте: %v", err))
+		}
+	}
+
+	// Супервизор воркеров: состояние, backoff после ошибок и управление из Telegram
+	supervisor := worker.NewSupervisor(logLoger)
 
 	// Инициализация Telegram бота
-	bot, err := tgbot.NewTelegramBot(cfg, ringBuffer, storage, ex, profitStorage, sqlLiteDb)
+	bot, err := tgbot.NewTelegramBot(cfg, ringBuffer, storage, ex, profitStorage, sqlLiteDb, lots, placer, entryFilter, circuitBreaker, sched, supervisor)
 	if err != nil {
 		log.Fatalf("Ошибка инициализации Telegram бота: %v", err)
 	}
@@ -65,22 +166,98 @@ func main() {
 
 	// Инициализируем и запускаем воркеры
 	log.Println("Запуск воркеров...")
-	buyWorker := buy_v1.NewBot(cfg, ex, storage)
-	err = worker.Start(ctx, buyWorker, time.Second*5, logLoger)
-	if err != nil {
-		log.Fatalf("Ошибка запуска buyWorker: %v", err)
+	if instanceMonitor != nil {
+		err = supervisor.Start(ctx, instanceMonitor, time.Minute)
+		if err != nil {
+			log.Fatalf("Ошибка запуска instanceMonitor: %v", err)
+		}
 	}
-	sellWorker := sell_v1.NewBot(cfg, ex, storage)
-	err = worker.Start(ctx, sellWorker, time.Minute, logLoger)
+	if circuitBreaker != nil {
+		err = supervisor.Start(ctx, circuitBreaker, 15*time.Second)
+		if err != nil {
+			log.Fatalf("Ошибка запуска circuitBreaker: %v", err)
+		}
+	}
+	sizer := sizing.NewSizer(cfg, ex, sched)
+	if cfg.Ladder.Enabled {
+		// лесенка заменяет одиночные покупки buy_v1
+		ladderWorker := ladder_v1.NewBot(cfg, ex, storage, orders, lots, sizer, sched, ob, placer, circuitBreaker)
+		err = supervisor.Start(ctx, ladderWorker, 10*time.Second)
+		if err != nil {
+			log.Fatalf("Ошибка запуска ladderWorker: %v", err)
+		}
+	} else {
+		buyWorker := buy_v1.NewBot(cfg, ex, storage, orders, lots, entryFilter, sizer, sched, ob)
+		err = supervisor.Start(ctx, buyWorker, time.Second*5)
+		if err != nil {
+			log.Fatalf("Ошибка запуска buyWorker: %v", err)
+		}
+	}
+	sellWorker := sell_v1.NewBot(cfg, ex, orders, lots, placer, ob)
+	err = supervisor.Start(ctx, sellWorker, time.Minute)
 	if err != nil {
 		log.Fatalf("Ошибка запуска sellWorker: %v", err)
 	}
+	if cfg.Trailing.Enabled {
+		trailingWorker := trailing_v1.NewBot(cfg, ex, positions, lots, ob, placer, logLoger)
+		err = supervisor.Start(ctx, trailingWorker, 3*time.Second)
+		if err != nil {
+			log.Fatalf("Ошибка запуска trailingWorker: %v", err)
+		}
+	}
+	if cfg.StopLoss.Enabled {
+		stopLossWorker := stoploss_v1.NewBot(cfg, ex, positions, lots, ob, placer, logLoger)
+		err = supervisor.Start(ctx, stopLossWorker, 10*time.Second)
+		if err != nil {
+			log.Fatalf("Ошибка запуска stopLossWorker: %v", err)
+		}
+	}
+	if cfg.Consolidate.Enabled {
+		consolidateWorker := consolidate_v1.NewBot(cfg, ex, positions, lots, ob, placer, logLoger)
+		err = supervisor.Start(ctx, consolidateWorker, time.Minute)
+		if err != nil {
+			log.Fatalf("Ошибка запуска consolidateWorker: %v", err)
+		}
+	}
+	if cfg.Decay.Enabled {
+		decayWorker := decay_v1.NewBot(cfg, ex, positions, lots, feeTracker, ob, placer, logLoger)
+		err = supervisor.Start(ctx, decayWorker, 10*time.Minute)
+		if err != nil {
+			log.Fatalf("Ошибка запуска decayWorker: %v", err)
+		}
+	}
 	profitWorker := profit_calc.NewBot(cfg, ex, profitStorage)
-	err = worker.Start(ctx, profitWorker, 30*time.Minute, logLoger)
+	err = supervisor.Start(ctx, profitWorker, 30*time.Minute)
 	if err != nil {
 		log.Fatalf("Ошибка запуска profitWorker: %v", err)
 	}
 
+	var gridWorker *grid_v1.Bot
+	if cfg.Grid.Enabled {
+		gridRepo, err := repository.NewSQLiteGridRepository(sqlLiteDb.DB())
+		if err != nil {
+			log.Fatalf("Ошибка создания репозитория сетки: %v", err)
+		}
+		gridWorker = grid_v1.NewBot(cfg, ex, storage, gridRepo, ob, logLoger, circuitBreaker)
+		err = supervisor.Start(ctx, gridWorker, 10*time.Second)
+		if err != nil {
+			log.Fatalf("Ошибка запуска gridWorker: %v", err)
+		}
+	}
+
+	var dcaWorker *dca_v1.Bot
+	if cfg.DCA.Enabled {
+		dcaRepo, err := repository.NewSQLiteDCARepository(sqlLiteDb.DB())
+		if err != nil {
+			log.Fatalf("Ошибка создания репозитория сделки усреднения: %v", err)
+		}
+		dcaWorker = dca_v1.NewBot(cfg, ex, storage, dcaRepo, ob, logLoger, circuitBreaker)
+		err = supervisor.Start(ctx, dcaWorker, 10*time.Second)
+		if err != nil {
+			log.Fatalf("Ошибка запуска dcaWorker: %v", err)
+		}
+	}
+
 	log.Println("Запуск подписки на обновления ордеров...")
 	updateCh := make(chan exchange.OrderUpdate, 100)
 	err = ex.SubscribeOrderUpdates(ctx, updateCh)
@@ -89,7 +266,13 @@ func main() {
 	}
 
 	log.Println("Запуск лиснера ордеров...")
-	orderListener := listener.NewOrderListener(cfg, ex, updateCh, logLoger, storage)
+	orderListener := listener.NewOrderListener(cfg, ex, updateCh, logLoger, orders, positions, lots, placer)
+	if gridWorker != nil {
+		orderListener.AddHandler(gridWorker)
+	}
+	if dcaWorker != nil {
+		orderListener.AddHandler(dcaWorker)
+	}
 	orderListener.Start(ctx)
 
 	// Настраиваем graceful shutdown
@@ -99,7 +282,64 @@ func main() {
 	<-sigChan
 	log.Println("Получен сигнал завершения, останавливаем бота...")
 	cancel()
-	// TODO : подумать и почитать про закрытие соединения
+
+	// Ждём, пока воркеры доделают текущие ордера, лиснер и вебсокет остановятся
+	timeout := time.Duration(cfg.Shutdown.TimeoutSeconds) * time.Second
+	done := make(chan struct{})
+	go func() {
+		supervisor.Wait()
+		orderListener.Wait()
+		client.Wait()
+		if gridWorker != nil {
+			gridWorker.Wait()
+		}
+		if dcaWorker != nil {
+			dcaWorker.Wait()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Println("Воркеры, лиснер и вебсокет остановлены")
+	case <-time.After(timeout):
+		log.Printf("Воркеры не остановились за %s, завершаем принудительно", timeout)
+	}
+
+	if cfg.Shutdown.CancelBuys {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), timeout)
+		cancelBuys(shutdownCtx, cfg, client, ob, orders, lots)
+		shutdownCancel()
+	}
+
 	sqlLiteDb.Close()
 	log.Println("Бот остановлен")
 }
+
+// cancelBuys - отменяет неисполненные покупки бота (buy_v1 и лесенка).
+// Частично исполненные остаются: их исполненную часть после запуска продаст sell_v1.
+// Лиснер уже остановлен, поэтому отмена записывается в журнал здесь
+func cancelBuys(ctx context.Context, cfg config.Config, ex exchange.Exchange, ob *outbox.Outbox, orders repo.OrderStateRepo, lots repository.LotRepository) {
+	openOrders, err := ex.GetOpenOrders(ctx, cfg.Symbol)
+	if err != nil {
+		log.Printf("Ошибка получения открытых ордеров для отмены покупок: %v", err)
+		return
+	}
+	var canceled int
+	for _, order := range openOrders {
+		if order.Side != exchange.Buy || order.Status != exchange.New || !orders.Tracked(order.OrderID) {
+			continue
+		}
+		if err := ob.CancelOrder(ctx, cfg.Symbol, order.OrderID); err != nil {
+			log.Printf("Ошибка отмены покупки %s: %v", order.OrderID, err)
+			continue
+		}
+		if !orders.Transition(order.OrderID, repo.OrderCanceled, repo.OrderNew) {
+			continue
+		}
+		if err := lots.MarkBuyCanceled(ctx, order.OrderID); err != nil {
+			log.Printf("Ошибка записи отмены покупки %s в журнал: %v", order.OrderID, err)
+		}
+		canceled++
+	}
+	log.Printf("При остановке отменено покупок: %d", canceled)
+}
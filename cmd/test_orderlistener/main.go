@@ -5,9 +5,14 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"scalpingbot/internal/instance"
 	"scalpingbot/internal/listener"
 	"scalpingbot/internal/logger"
+	"scalpingbot/internal/outbox"
 	"scalpingbot/internal/repo"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/schedule"
+	"scalpingbot/internal/takeprofit"
 	"syscall"
 
 	"scalpingbot/internal/config"
@@ -38,7 +43,28 @@ func main() {
 	}
 
 	log.Println("Запуск лиснера ордеров...")
-	orderListener := listener.NewOrderListener(cfg, ex, updateCh, logLoger, repo.NewSafeSet())
+	sqlLiteDb, err := repository.NewSQLiteUserRepository(cfg.DbPath)
+	if err != nil {
+		log.Fatalf("Ошибка создания SQLite репозитория: %v", err)
+	}
+	defer sqlLiteDb.Close()
+	lots, err := repository.NewSQLiteLotRepository(sqlLiteDb.DB())
+	if err != nil {
+		log.Fatalf("Ошибка создания журнала позиций: %v", err)
+	}
+	outboxRepo, err := repository.NewSQLiteOutboxRepository(sqlLiteDb.DB())
+	if err != nil {
+		log.Fatalf("Ошибка создания журнала намерений: %v", err)
+	}
+	ob := outbox.New(cfg, ex, outboxRepo, instance.NewID())
+	positions := repo.NewPositionStorage()
+	orders := repo.NewOrderStateStorage()
+	sched, err := schedule.New(cfg)
+	if err != nil {
+		log.Fatalf("Ошибка загрузки расписания: %v", err)
+	}
+	placer := takeprofit.NewPlacer(cfg, ex, positions, orders, lots, nil, sched, ob)
+	orderListener := listener.NewOrderListener(cfg, ex, updateCh, logLoger, orders, positions, lots, placer)
 	orderListener.Start(ctx)
 
 	// Настраиваем graceful shutdown
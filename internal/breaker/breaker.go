@@ -0,0 +1,171 @@
+// Package breaker - аварийный выключатель покупок: при резком падении цены или
+// аномальном объёме покупки останавливаются на время cooldown. Сработавший
+// выключатель блокирует покупки так же, как лимиты риска (exchange.ErrBlocked).
+// Уже стоящие покупки выключатель не трогает: лесенка, сетка и DCA проверяют Tripped
+// в каждом цикле и сами снимают свои покупки, одиночные покупки buy_v1 снимает sell_v1 по таймауту
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/logger"
+	"sync"
+	"time"
+)
+
+// Breaker - проверка рынка и состояние выключателя
+type Breaker struct {
+	cfg      config.Config
+	exchange exchange.Exchange
+	logger   logger.Logger
+
+	mu           sync.Mutex
+	trippedUntil time.Time
+	reason       string
+}
+
+// NewBreaker - конструктор. ex - биржа без обёртки
+func NewBreaker(cfg config.Config, ex exchange.Exchange, logLogger logger.Logger) *Breaker {
+	return &Breaker{cfg: cfg, exchange: ex, logger: logLogger}
+}
+
+// Process - проверка падения цены и объёма, запускается как воркер
+func (b *Breaker) Process(ctx context.Context) error {
+	if tripped, _, _ := b.State(); tripped {
+		return nil
+	}
+	b.mu.Lock()
+	if b.reason != "" {
+		// cooldown закончился
+		log.Printf("Аварийный выключатель: cooldown закончился, покупки возобновлены")
+		b.logger.Notify("Аварийный выключатель: cooldown закончился, покупки возобновлены")
+		b.reason = ""
+	}
+	b.mu.Unlock()
+
+	settings := b.cfg.CircuitBreaker
+	klines, err := b.exchange.GetKlines(ctx, b.cfg.Symbol, exchange.KlineInterval1m, max(settings.WindowMinutes, settings.VolumeLookback+1))
+	if err != nil {
+		return err
+	}
+	if len(klines) == 0 {
+		return nil
+	}
+	price, err := b.exchange.GetPrice(ctx, b.cfg.Symbol)
+	if err != nil {
+		return err
+	}
+
+	if settings.DropPercent > 0 {
+		var high float64
+		for _, k := range klines[max(len(klines)-settings.WindowMinutes, 0):] {
+			high = math.Max(high, k.High)
+		}
+		if drop := (high - price) / high * 100; drop >= settings.DropPercent {
+			b.trip(fmt.Sprintf("цена упала на %.2f%% за %d мин (%.8f -> %.8f)", drop, settings.WindowMinutes, high, price))
+			return nil
+		}
+	}
+
+	if settings.VolumeMultiplier > 0 && len(klines) > 1 {
+		last := klines[len(klines)-1]
+		previous := klines[max(len(klines)-1-settings.VolumeLookback, 0) : len(klines)-1]
+		var sum float64
+		for _, k := range previous {
+			sum += k.Volume
+		}
+		avg := sum / float64(len(previous))
+		if avg > 0 && last.Volume >= avg*settings.VolumeMultiplier {
+			b.trip(fmt.Sprintf("объём свечи %.2f в %.1f раз выше среднего %.2f", last.Volume, last.Volume/avg, avg))
+		}
+	}
+	return nil
+}
+
+func (b *Breaker) Name() string {
+	return "breaker"
+}
+
+// State - сработал ли выключатель, причина и до какого времени
+func (b *Breaker) State() (bool, string, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Now().Before(b.trippedUntil), b.reason, b.trippedUntil
+}
+
+// Tripped - сработал ли выключатель. nil - выключатель отключён в конфиге
+func (b *Breaker) Tripped() bool {
+	if b == nil {
+		return false
+	}
+	tripped, _, _ := b.State()
+	return tripped
+}
+
+// Reset - ручной сброс выключателя
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trippedUntil = time.Time{}
+	b.reason = ""
+	log.Printf("Аварийный выключатель сброшен вручную")
+}
+
+func (b *Breaker) trip(reason string) {
+	b.mu.Lock()
+	b.trippedUntil = time.Now().Add(time.Duration(b.cfg.CircuitBreaker.CooldownMinutes) * time.Minute)
+	b.reason = reason
+	until := b.trippedUntil
+	b.mu.Unlock()
+
+	msg := fmt.Sprintf("Аварийный выключатель сработал: %s. Покупки остановлены до %s, сброс: /reset_breaker",
+		reason, until.Format(time.TimeOnly))
+	log.Print(msg)
+	b.logger.Notify(msg)
+}
+
+// check - ошибка для покупки при сработавшем выключателе
+func (b *Breaker) check(req exchange.SpotOrderRequest) error {
+	if req.Side != exchange.Buy {
+		return nil
+	}
+	tripped, reason, until := b.State()
+	if !tripped {
+		return nil
+	}
+	log.Printf("Покупка заблокирована аварийным выключателем до %s: %s", until.Format(time.TimeOnly), reason)
+	return fmt.Errorf("%w: аварийный выключатель: %s", exchange.ErrBlocked, reason)
+}
+
+// Guard - биржа, которая не пропускает покупки при сработавшем выключателе
+type Guard struct {
+	exchange.Exchange
+	breaker *Breaker
+}
+
+// NewGuard - обёртка над биржей
+func NewGuard(ex exchange.Exchange, breaker *Breaker) *Guard {
+	return &Guard{Exchange: ex, breaker: breaker}
+}
+
+// PlaceOrder - размещение ордера, если выключатель не сработал
+func (g *Guard) PlaceOrder(ctx context.Context, req exchange.SpotOrderRequest) (*exchange.OrderResponse, error) {
+	if err := g.breaker.check(req); err != nil {
+		return nil, err
+	}
+	return g.Exchange.PlaceOrder(ctx, req)
+}
+
+// PlaceBatchOrders - размещение пачки ордеров, если выключатель не сработал
+func (g *Guard) PlaceBatchOrders(ctx context.Context, reqs []exchange.SpotOrderRequest) ([]exchange.OrderResponse, error) {
+	for _, req := range reqs {
+		if err := g.breaker.check(req); err != nil {
+			return nil, err
+		}
+	}
+	return g.Exchange.PlaceBatchOrders(ctx, reqs)
+}
@@ -3,22 +3,252 @@ package config
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"scalpingbot/internal/tools"
+	"strings"
+	"time"
+	_ "time/tzdata" // часовые пояса расписания без системной базы
 
 	"github.com/spf13/viper"
 )
 
 // Config - структура конфигурации бота
 type Config struct {
-	ProfitPercent  float64 `mapstructure:"profit_percent" json:"profit_percent,omitempty"`
-	OrderSize      float64 `mapstructure:"order_size" json:"order_size,omitempty"`
-	APIKey         string  `mapstructure:"api_key" json:"api_key,omitempty"`
-	SecretKey      string  `mapstructure:"secret_key" json:"secret_key,omitempty"`
-	Symbol         string  `mapstructure:"symbol" json:"symbol,omitempty"` // Например, "KASUSDT"
-	BaseBuyTimeout int     `mapstructure:"base_buy_timeout" json:"base_buy_timeout,omitempty"`
-	TgToken        string  `mapstructure:"tg_token" json:"token,omitempty"`
-	TgChatID       int64   `mapstructure:"tg_chat_id"  json:"chat_id,omitempty"`
-	DbPath         string  `mapstructure:"db_path" json:"db_path,omitempty"`
+	ProfitPercent    float64 `mapstructure:"profit_percent" json:"profit_percent,omitempty"`
+	OrderSize        float64 `mapstructure:"order_size" json:"order_size,omitempty"`
+	OrderSizeMode    string  `mapstructure:"order_size_mode" json:"order_size_mode,omitempty"`       // base, quote или equity
+	OrderSizeQuote   float64 `mapstructure:"order_size_quote" json:"order_size_quote,omitempty"`     // Размер покупки в USDT для режима quote
+	OrderSizePercent float64 `mapstructure:"order_size_percent" json:"order_size_percent,omitempty"` // Процент от капитала для режима equity
+	APIKey           string  `mapstructure:"api_key" json:"api_key,omitempty"`
+	SecretKey        string  `mapstructure:"secret_key" json:"secret_key,omitempty"`
+	Symbol           string  `mapstructure:"symbol" json:"symbol,omitempty"` // Например, "KASUSDT"
+	BaseBuyTimeout   int     `mapstructure:"base_buy_timeout" json:"base_buy_timeout,omitempty"`
+	TgToken          string  `mapstructure:"tg_token" json:"token,omitempty"`
+	TgChatID         int64   `mapstructure:"tg_chat_id"  json:"chat_id,omitempty"`
+	DbPath           string  `mapstructure:"db_path" json:"db_path,omitempty"`
+	DropPercent      float64 `mapstructure:"drop_percent" json:"drop_percent,omitempty"`   // Покупать после падения от локального максимума, 0 - выключено
+	DelaySeconds     int     `mapstructure:"delay_seconds" json:"delay_seconds,omitempty"` // Минимальная пауза между покупками, 0 - без паузы
+	Deposit          float64 `mapstructure:"deposit" json:"deposit,omitempty"`             // Лимит капитала в работе в USDT, 0 - без ограничения
+
+	Grid GridConfig `mapstructure:"grid" json:"grid,omitempty"`
+	DCA  DCAConfig  `mapstructure:"dca" json:"dca,omitempty"`
+
+	Trailing TrailingConfig `mapstructure:"trailing" json:"trailing,omitempty"`
+	StopLoss StopLossConfig `mapstructure:"stop_loss" json:"stop_loss,omitempty"`
+
+	AdaptiveProfit AdaptiveProfitConfig `mapstructure:"adaptive_profit" json:"adaptive_profit,omitempty"`
+	EntryFilter    EntryFilterConfig    `mapstructure:"entry_filter" json:"entry_filter,omitempty"`
+	Reconcile      ReconcileConfig      `mapstructure:"reconcile" json:"reconcile,omitempty"`
+	Consolidate    ConsolidateConfig    `mapstructure:"consolidate" json:"consolidate,omitempty"`
+	Decay          DecayConfig          `mapstructure:"tp_decay" json:"tp_decay,omitempty"`
+	Risk           RiskConfig           `mapstructure:"risk" json:"risk,omitempty"`
+	Fees           FeesConfig           `mapstructure:"fees" json:"fees,omitempty"`
+	MakerBuy       MakerBuyConfig       `mapstructure:"maker_buy" json:"maker_buy,omitempty"`
+	Ladder         LadderConfig         `mapstructure:"ladder" json:"ladder,omitempty"`
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker" json:"circuit_breaker,omitempty"`
+	Schedule       ScheduleConfig       `mapstructure:"schedule" json:"schedule,omitempty"`
+	Shutdown       ShutdownConfig       `mapstructure:"shutdown" json:"shutdown,omitempty"`
+	Instance       InstanceConfig       `mapstructure:"instance" json:"instance,omitempty"`
+}
+
+// InstanceConfig - защита от второй копии бота на том же API ключе
+type InstanceConfig struct {
+	Enabled         bool   `mapstructure:"enabled" json:"enabled,omitempty"`
+	LockFile        string `mapstructure:"lock_file" json:"lock_file,omitempty"`
+	ClientIDPrefix  string `mapstructure:"client_id_prefix" json:"client_id_prefix,omitempty"` // Префикс client order ID ордеров бота
+	LookbackMinutes int    `mapstructure:"lookback_minutes" json:"lookback_minutes,omitempty"` // За сколько минут искать ордера другой копии
+}
+
+// ShutdownConfig - остановка бота по сигналу
+type ShutdownConfig struct {
+	TimeoutSeconds int  `mapstructure:"timeout_seconds" json:"timeout_seconds,omitempty"` // Сколько ждать завершения воркеров и лиснера
+	CancelBuys     bool `mapstructure:"cancel_buys" json:"cancel_buys,omitempty"`         // Отменить неисполненные покупки buy_v1/лесенки
+}
+
+// ScheduleConfig - окна времени с профилями параметров. Вне окон покупки разрешены только при outside_buy
+type ScheduleConfig struct {
+	Enabled    bool             `mapstructure:"enabled" json:"enabled,omitempty"`
+	Timezone   string           `mapstructure:"timezone" json:"timezone,omitempty"`       // Например, "Europe/Moscow"
+	OutsideBuy bool             `mapstructure:"outside_buy" json:"outside_buy,omitempty"` // Покупать вне окон с базовыми параметрами
+	Windows    []ScheduleWindow `mapstructure:"windows" json:"windows,omitempty"`         // Действует первое подходящее окно
+}
+
+// ScheduleWindow - окно времени и параметры в нём. 0 - базовое значение из конфига
+type ScheduleWindow struct {
+	Name           string   `mapstructure:"name" json:"name,omitempty"`
+	Days           []string `mapstructure:"days" json:"days,omitempty"`   // mon..sun, пусто - каждый день
+	Start          string   `mapstructure:"start" json:"start,omitempty"` // "22:00"
+	End            string   `mapstructure:"end" json:"end,omitempty"`     // "06:00" не включительно, если не позже start - окно через полночь
+	Pause          bool     `mapstructure:"pause" json:"pause,omitempty"` // Не покупать в этом окне
+	ProfitPercent  float64  `mapstructure:"profit_percent" json:"profit_percent,omitempty"`
+	BaseBuyTimeout int      `mapstructure:"base_buy_timeout" json:"base_buy_timeout,omitempty"`
+	SizeMultiplier float64  `mapstructure:"size_multiplier" json:"size_multiplier,omitempty"` // Множитель размера покупки
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Weekdays - дни недели окна, пустой список - все дни
+func (w ScheduleWindow) Weekdays() (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool, 7)
+	for _, name := range w.Days {
+		day, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("неизвестный день недели %q", name)
+		}
+		days[day] = true
+	}
+	if len(days) == 0 {
+		for _, day := range weekdays {
+			days[day] = true
+		}
+	}
+	return days, nil
+}
+
+// Minutes - начало и конец окна в минутах от полуночи
+func (w ScheduleWindow) Minutes() (int, int, error) {
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return 0, 0, fmt.Errorf("некорректное начало окна %q", w.Start)
+	}
+	end, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return 0, 0, fmt.Errorf("некорректный конец окна %q", w.End)
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
+}
+
+// CircuitBreakerConfig - остановка покупок при резком падении цены или всплеске объёма
+type CircuitBreakerConfig struct {
+	Enabled          bool    `mapstructure:"enabled" json:"enabled,omitempty"`
+	DropPercent      float64 `mapstructure:"drop_percent" json:"drop_percent,omitempty"`           // Падение от максимума за window_minutes, 0 - не проверять
+	WindowMinutes    int     `mapstructure:"window_minutes" json:"window_minutes,omitempty"`       // Окно для drop_percent в минутах
+	VolumeMultiplier float64 `mapstructure:"volume_multiplier" json:"volume_multiplier,omitempty"` // Объём минутной свечи во столько раз выше среднего, 0 - не проверять
+	VolumeLookback   int     `mapstructure:"volume_lookback" json:"volume_lookback,omitempty"`     // За сколько свечей считать средний объём
+	CooldownMinutes  int     `mapstructure:"cooldown_minutes" json:"cooldown_minutes,omitempty"`   // Сколько минут покупки остановлены после срабатывания
+}
+
+// LadderConfig - лесенка покупок ниже рынка вместо одной покупки buy_v1
+type LadderConfig struct {
+	Enabled        bool    `mapstructure:"enabled" json:"enabled,omitempty"`
+	Levels         int     `mapstructure:"levels" json:"levels,omitempty"`                   // Сколько покупок держать
+	OffsetPercent  float64 `mapstructure:"offset_percent" json:"offset_percent,omitempty"`   // Первая покупка ниже цены на столько процентов
+	StepPercent    float64 `mapstructure:"step_percent" json:"step_percent,omitempty"`       // Расстояние между покупками в процентах
+	RefreshPercent float64 `mapstructure:"refresh_percent" json:"refresh_percent,omitempty"` // Перестраивать лесенку, когда цена ушла на столько процентов
+}
+
+// MakerBuyConfig - покупки buy_v1 только maker по лучшему bid с перестановкой за ценой
+type MakerBuyConfig struct {
+	Enabled         bool    `mapstructure:"enabled" json:"enabled,omitempty"`
+	OffsetTicks     int     `mapstructure:"offset_ticks" json:"offset_ticks,omitempty"`           // На сколько шагов цены ниже bid ставить покупку
+	ChaseTicks      int     `mapstructure:"chase_ticks" json:"chase_ticks,omitempty"`             // Переставлять, когда bid ушёл выше покупки больше чем на столько шагов
+	MaxChasePercent float64 `mapstructure:"max_chase_percent" json:"max_chase_percent,omitempty"` // Максимальное удаление от первой цены покупки
+}
+
+// FeesConfig - учёт комиссий в цене тейк-профита. Ставки берутся с биржи, из конфига - если запрос не удался
+type FeesConfig struct {
+	Enabled      bool    `mapstructure:"enabled" json:"enabled,omitempty"`
+	MakerPercent float64 `mapstructure:"maker_percent" json:"maker_percent,omitempty"`
+	TakerPercent float64 `mapstructure:"taker_percent" json:"taker_percent,omitempty"`
+	BuySide      string  `mapstructure:"buy_side" json:"buy_side,omitempty"` // Какой комиссией считать покупку: taker или maker
+}
+
+// RiskConfig - лимиты, которые проверяются перед каждой покупкой. 0 - лимит выключен
+type RiskConfig struct {
+	Enabled          bool    `mapstructure:"enabled" json:"enabled,omitempty"`
+	MaxQuoteCapital  float64 `mapstructure:"max_quote_capital" json:"max_quote_capital,omitempty"`   // Максимум USDT в работе (открытые покупки и непроданные монеты)
+	MaxBaseInventory float64 `mapstructure:"max_base_inventory" json:"max_base_inventory,omitempty"` // Максимум монет на балансе, включая зарезервированные в продажах
+	MaxBuysPerHour   int     `mapstructure:"max_buys_per_hour" json:"max_buys_per_hour,omitempty"`
+	MaxOpenBuys      int     `mapstructure:"max_open_buys" json:"max_open_buys,omitempty"`
+	MaxDailyLoss     float64 `mapstructure:"max_daily_loss" json:"max_daily_loss,omitempty"` // Реализованный убыток за день в USDT, после которого покупки запрещены
+	Alert            bool    `mapstructure:"alert" json:"alert,omitempty"`                   // Сообщать о блокировках в Telegram
+}
+
+// DecayConfig - снижение цели старых продаж к безубытку по расписанию возраста
+type DecayConfig struct {
+	Enabled      bool        `mapstructure:"enabled" json:"enabled,omitempty"`
+	Schedule     []DecayStep `mapstructure:"schedule" json:"schedule,omitempty"`
+	FloorPercent float64     `mapstructure:"floor_percent" json:"floor_percent,omitempty"` // Цель никогда не ниже входа + floor_percent
+}
+
+// DecayStep - после after_hours цель продажи снижается до percent от цены входа
+type DecayStep struct {
+	AfterHours float64 `mapstructure:"after_hours" json:"after_hours,omitempty"`
+	Percent    float64 `mapstructure:"percent" json:"percent,omitempty"`
+}
+
+// ConsolidateConfig - объединение соседних продаж в одну, чтобы не упираться в лимит открытых ордеров
+type ConsolidateConfig struct {
+	Enabled          bool    `mapstructure:"enabled" json:"enabled,omitempty"`
+	Threshold        int     `mapstructure:"threshold" json:"threshold,omitempty"`                   // С какого количества открытых ордеров объединять
+	GroupSize        int     `mapstructure:"group_size" json:"group_size,omitempty"`                 // Сколько продаж объединять в один ордер
+	MaxSpreadPercent float64 `mapstructure:"max_spread_percent" json:"max_spread_percent,omitempty"` // Максимальный разброс цен внутри группы
+	PriceStep        float64 `mapstructure:"price_step" json:"price_step,omitempty"`                 // Округление цены вверх до шага, 0 - без округления
+}
+
+// ReconcileConfig - сверка журнала с биржей при старте
+type ReconcileConfig struct {
+	Enabled        bool `mapstructure:"enabled" json:"enabled,omitempty"`
+	LookbackHours  int  `mapstructure:"lookback_hours" json:"lookback_hours,omitempty"`   // За сколько часов смотреть историю ордеров
+	AutoSell       bool `mapstructure:"auto_sell" json:"auto_sell,omitempty"`             // Ставить недостающие продажи автоматически, иначе только отчёт
+	TrackUntracked bool `mapstructure:"track_untracked" json:"track_untracked,omitempty"` // Брать в работу открытые покупки, которых нет в журнале
+}
+
+// EntryFilterConfig - правила, которые проверяются перед каждой покупкой buy_v1
+type EntryFilterConfig struct {
+	Enabled bool     `mapstructure:"enabled" json:"enabled,omitempty"`
+	Mode    string   `mapstructure:"mode" json:"mode,omitempty"` // and - все правила, or - хотя бы одно
+	Rules   []string `mapstructure:"rules" json:"rules,omitempty"`
+}
+
+// AdaptiveProfitConfig - процент тейк-профита от волатильности (ATR) вместо фиксированного profit_percent
+type AdaptiveProfitConfig struct {
+	Enabled    bool    `mapstructure:"enabled" json:"enabled,omitempty"`
+	Interval   string  `mapstructure:"interval" json:"interval,omitempty"`     // Интервал свечей для ATR
+	Period     int     `mapstructure:"period" json:"period,omitempty"`         // Период ATR
+	Multiplier float64 `mapstructure:"multiplier" json:"multiplier,omitempty"` // Процент = ATR/цена*100*multiplier
+	MinPercent float64 `mapstructure:"min_percent" json:"min_percent,omitempty"`
+	MaxPercent float64 `mapstructure:"max_percent" json:"max_percent,omitempty"`
+}
+
+// StopLossConfig - настройки выхода из позиции по стоп-лоссу и времени удержания
+type StopLossConfig struct {
+	Enabled           bool    `mapstructure:"enabled" json:"enabled,omitempty"`
+	Percent           float64 `mapstructure:"percent" json:"percent,omitempty"`                         // Стоп-лосс в процентах ниже цены входа, 0 - выключен
+	MaxHoldingHours   float64 `mapstructure:"max_holding_hours" json:"max_holding_hours,omitempty"`     // Максимальное время удержания позиции, 0 - без ограничения
+	ExitMode          string  `mapstructure:"exit_mode" json:"exit_mode,omitempty"`                     // market или limit
+	ExitOffsetPercent float64 `mapstructure:"exit_offset_percent" json:"exit_offset_percent,omitempty"` // Для limit: насколько ниже текущей цены ставить ордер
+	MaxDailyStopOuts  int     `mapstructure:"max_daily_stop_outs" json:"max_daily_stop_outs,omitempty"` // Лимит выходов по стопу за день, 0 - без ограничения
+}
+
+// TrailingConfig - настройки трейлинг тейк-профита
+type TrailingConfig struct {
+	Enabled           bool    `mapstructure:"enabled" json:"enabled,omitempty"`
+	CallbackPercent   float64 `mapstructure:"callback_percent" json:"callback_percent,omitempty"`     // Откат от максимума, после которого продаём
+	ProtectivePercent float64 `mapstructure:"protective_percent" json:"protective_percent,omitempty"` // Насколько выше тейк-профита стоит защитный лимитный ордер
+}
+
+// GridConfig - настройки сеточной стратегии (grid_v1)
+type GridConfig struct {
+	Enabled    bool    `mapstructure:"enabled" json:"enabled,omitempty"`
+	LowerPrice float64 `mapstructure:"lower_price" json:"lower_price,omitempty"`
+	UpperPrice float64 `mapstructure:"upper_price" json:"upper_price,omitempty"`
+	Levels     int     `mapstructure:"levels" json:"levels,omitempty"`
+	OrderSize  float64 `mapstructure:"order_size" json:"order_size,omitempty"` // Размер ордера на уровне (не в USDT)
+	Recenter   bool    `mapstructure:"recenter" json:"recenter,omitempty"`     // Перестраивать сетку вокруг цены при выходе из диапазона
+}
+
+// DCAConfig - настройки стратегии усреднения (dca_v1)
+type DCAConfig struct {
+	Enabled           bool    `mapstructure:"enabled" json:"enabled,omitempty"`
+	BaseOrderSize     float64 `mapstructure:"base_order_size" json:"base_order_size,omitempty"`         // Размер первой покупки (не в USDT)
+	SafetyOrders      int     `mapstructure:"safety_orders" json:"safety_orders,omitempty"`             // Количество страховочных ордеров
+	StepPercent       float64 `mapstructure:"step_percent" json:"step_percent,omitempty"`               // Шаг падения цены между страховочными ордерами
+	SizeMultiplier    float64 `mapstructure:"size_multiplier" json:"size_multiplier,omitempty"`         // Множитель объёма каждого следующего страховочного ордера
+	TakeProfitPercent float64 `mapstructure:"take_profit_percent" json:"take_profit_percent,omitempty"` // Тейк-профит от средней цены входа
 }
 
 // LoadConfig - загрузка конфигурации через Viper
@@ -29,13 +259,68 @@ func LoadConfig() (Config, error) {
 
 	// Значения по умолчанию
 	viper.SetDefault("profit_percent", 0.3)
-	viper.SetDefault("drop_percent", 1.0)
-	viper.SetDefault("delay_seconds", 30)
+	viper.SetDefault("drop_percent", 0.0)
+	viper.SetDefault("delay_seconds", 0)
 	viper.SetDefault("order_size", 40.0)
-	viper.SetDefault("deposit", 400.0)
+	viper.SetDefault("order_size_mode", "base")
+	viper.SetDefault("deposit", 0.0)
 	viper.SetDefault("api_key", "")
 	viper.SetDefault("secret_key", "")
 	viper.SetDefault("symbol", "KASUSDT") // Kaspa как пример
+	viper.SetDefault("grid.enabled", false)
+	viper.SetDefault("grid.levels", 10)
+	viper.SetDefault("trailing.enabled", false)
+	viper.SetDefault("trailing.callback_percent", 0.1)
+	viper.SetDefault("trailing.protective_percent", 1.0)
+	viper.SetDefault("stop_loss.enabled", false)
+	viper.SetDefault("stop_loss.exit_mode", "market")
+	viper.SetDefault("adaptive_profit.enabled", false)
+	viper.SetDefault("adaptive_profit.interval", "5m")
+	viper.SetDefault("adaptive_profit.period", 14)
+	viper.SetDefault("adaptive_profit.multiplier", 1.0)
+	viper.SetDefault("entry_filter.enabled", false)
+	viper.SetDefault("entry_filter.mode", "and")
+	viper.SetDefault("reconcile.enabled", true)
+	viper.SetDefault("reconcile.lookback_hours", 72)
+	viper.SetDefault("reconcile.auto_sell", false)
+	viper.SetDefault("reconcile.track_untracked", false)
+	viper.SetDefault("consolidate.enabled", false)
+	viper.SetDefault("consolidate.threshold", 450)
+	viper.SetDefault("consolidate.group_size", 5)
+	viper.SetDefault("consolidate.max_spread_percent", 1.0)
+	viper.SetDefault("tp_decay.enabled", false)
+	viper.SetDefault("risk.enabled", false)
+	viper.SetDefault("risk.alert", true)
+	viper.SetDefault("fees.enabled", false)
+	viper.SetDefault("fees.maker_percent", 0.0)
+	viper.SetDefault("fees.taker_percent", 0.05)
+	viper.SetDefault("fees.buy_side", "taker")
+	viper.SetDefault("maker_buy.enabled", false)
+	viper.SetDefault("maker_buy.chase_ticks", 3)
+	viper.SetDefault("maker_buy.max_chase_percent", 0.5)
+	viper.SetDefault("ladder.enabled", false)
+	viper.SetDefault("ladder.levels", 5)
+	viper.SetDefault("ladder.offset_percent", 0.5)
+	viper.SetDefault("ladder.step_percent", 0.5)
+	viper.SetDefault("ladder.refresh_percent", 1.0)
+	viper.SetDefault("circuit_breaker.enabled", false)
+	viper.SetDefault("circuit_breaker.drop_percent", 3.0)
+	viper.SetDefault("circuit_breaker.window_minutes", 5)
+	viper.SetDefault("circuit_breaker.volume_multiplier", 5.0)
+	viper.SetDefault("circuit_breaker.volume_lookback", 60)
+	viper.SetDefault("circuit_breaker.cooldown_minutes", 30)
+	viper.SetDefault("schedule.enabled", false)
+	viper.SetDefault("schedule.timezone", "UTC")
+	viper.SetDefault("shutdown.timeout_seconds", 30)
+	viper.SetDefault("shutdown.cancel_buys", false)
+	viper.SetDefault("instance.enabled", true)
+	viper.SetDefault("instance.lock_file", "data/scalpingbot.lock")
+	viper.SetDefault("instance.client_id_prefix", "sb")
+	viper.SetDefault("instance.lookback_minutes", 30)
+	viper.SetDefault("dca.enabled", false)
+	viper.SetDefault("dca.safety_orders", 5)
+	viper.SetDefault("dca.step_percent", 1.5)
+	viper.SetDefault("dca.size_multiplier", 1.5)
 
 	err := viper.ReadInConfig()
 	if err != nil {
@@ -60,6 +345,157 @@ func LoadConfig() (Config, error) {
 	if cfg.APIKey == "" || cfg.SecretKey == "" {
 		return Config{}, fmt.Errorf("API Key и Secret Key обязательны для MEXC")
 	}
+	if cfg.DropPercent < 0 || cfg.DelaySeconds < 0 || cfg.Deposit < 0 {
+		return Config{}, fmt.Errorf("drop_percent, delay_seconds и deposit не могут быть отрицательными")
+	}
+	switch cfg.OrderSizeMode {
+	case "base":
+		if cfg.OrderSize <= 0 {
+			return Config{}, fmt.Errorf("order_size должен быть положительным")
+		}
+	case "quote":
+		if cfg.OrderSizeQuote <= 0 {
+			return Config{}, fmt.Errorf("order_size_quote должен быть положительным")
+		}
+	case "equity":
+		if cfg.OrderSizePercent <= 0 || cfg.OrderSizePercent > 100 {
+			return Config{}, fmt.Errorf("order_size_percent должен быть от 0 до 100")
+		}
+	default:
+		return Config{}, fmt.Errorf("order_size_mode должен быть base, quote или equity")
+	}
+	if cfg.Grid.Enabled {
+		if cfg.Grid.LowerPrice <= 0 || cfg.Grid.UpperPrice <= cfg.Grid.LowerPrice {
+			return Config{}, fmt.Errorf("grid: некорректный диапазон цен %.8f - %.8f", cfg.Grid.LowerPrice, cfg.Grid.UpperPrice)
+		}
+		if cfg.Grid.Levels < 2 {
+			return Config{}, fmt.Errorf("grid: количество уровней должно быть >= 2")
+		}
+		if cfg.Grid.OrderSize <= 0 {
+			return Config{}, fmt.Errorf("grid: размер ордера должен быть положительным")
+		}
+	}
+
+	if cfg.Trailing.Enabled && (cfg.Trailing.CallbackPercent <= 0 || cfg.Trailing.ProtectivePercent <= 0) {
+		return Config{}, fmt.Errorf("trailing: callback_percent и protective_percent должны быть положительными")
+	}
+	if cfg.StopLoss.Enabled {
+		if cfg.StopLoss.ExitMode != "market" && cfg.StopLoss.ExitMode != "limit" {
+			return Config{}, fmt.Errorf("stop_loss: exit_mode должен быть market или limit")
+		}
+		if cfg.StopLoss.Percent < 0 || cfg.StopLoss.MaxHoldingHours < 0 || cfg.StopLoss.ExitOffsetPercent < 0 {
+			return Config{}, fmt.Errorf("stop_loss: значения не могут быть отрицательными")
+		}
+	}
+	if cfg.AdaptiveProfit.Enabled {
+		if cfg.AdaptiveProfit.Period <= 0 || cfg.AdaptiveProfit.Multiplier <= 0 {
+			return Config{}, fmt.Errorf("adaptive_profit: period и multiplier должны быть положительными")
+		}
+		if cfg.AdaptiveProfit.MinPercent <= 0 || cfg.AdaptiveProfit.MaxPercent < cfg.AdaptiveProfit.MinPercent {
+			return Config{}, fmt.Errorf("adaptive_profit: некорректные границы min_percent/max_percent")
+		}
+	}
+	if cfg.EntryFilter.Enabled && cfg.EntryFilter.Mode != "and" && cfg.EntryFilter.Mode != "or" {
+		return Config{}, fmt.Errorf("entry_filter: mode должен быть and или or")
+	}
+	if cfg.Consolidate.Enabled {
+		if cfg.Consolidate.Threshold <= 0 || cfg.Consolidate.GroupSize < 2 {
+			return Config{}, fmt.Errorf("consolidate: threshold должен быть положительным, group_size >= 2")
+		}
+		if cfg.Consolidate.MaxSpreadPercent <= 0 || cfg.Consolidate.PriceStep < 0 {
+			return Config{}, fmt.Errorf("consolidate: некорректные max_spread_percent или price_step")
+		}
+	}
+	if cfg.Decay.Enabled {
+		if len(cfg.Decay.Schedule) == 0 {
+			return Config{}, fmt.Errorf("tp_decay: пустое расписание")
+		}
+		for _, step := range cfg.Decay.Schedule {
+			if step.AfterHours <= 0 || step.Percent < 0 {
+				return Config{}, fmt.Errorf("tp_decay: некорректный шаг расписания %.1f ч / %.3f%%", step.AfterHours, step.Percent)
+			}
+		}
+	}
+	if cfg.Risk.Enabled {
+		if cfg.Risk.MaxQuoteCapital < 0 || cfg.Risk.MaxBaseInventory < 0 || cfg.Risk.MaxBuysPerHour < 0 ||
+			cfg.Risk.MaxOpenBuys < 0 || cfg.Risk.MaxDailyLoss < 0 {
+			return Config{}, fmt.Errorf("risk: лимиты не могут быть отрицательными")
+		}
+	}
+	if cfg.Fees.Enabled {
+		if cfg.Fees.BuySide != "taker" && cfg.Fees.BuySide != "maker" {
+			return Config{}, fmt.Errorf("fees: buy_side должен быть taker или maker")
+		}
+		if cfg.Fees.MakerPercent < 0 || cfg.Fees.TakerPercent < 0 {
+			return Config{}, fmt.Errorf("fees: комиссии не могут быть отрицательными")
+		}
+	}
+	if cfg.MakerBuy.Enabled {
+		if cfg.MakerBuy.OffsetTicks < 0 || cfg.MakerBuy.ChaseTicks <= 0 || cfg.MakerBuy.MaxChasePercent < 0 {
+			return Config{}, fmt.Errorf("maker_buy: offset_ticks >= 0, chase_ticks > 0, max_chase_percent >= 0")
+		}
+	}
+	if cfg.Ladder.Enabled {
+		if cfg.Ladder.Levels <= 0 || cfg.Ladder.StepPercent <= 0 || cfg.Ladder.OffsetPercent < 0 || cfg.Ladder.RefreshPercent <= 0 {
+			return Config{}, fmt.Errorf("ladder: levels, step_percent и refresh_percent должны быть положительными")
+		}
+		if cfg.Ladder.OffsetPercent+cfg.Ladder.StepPercent*float64(cfg.Ladder.Levels-1) >= 100 {
+			return Config{}, fmt.Errorf("ladder: нижняя покупка лесенки ниже нуля")
+		}
+	}
+	if cfg.CircuitBreaker.Enabled {
+		cb := cfg.CircuitBreaker
+		if cb.DropPercent < 0 || cb.VolumeMultiplier < 0 {
+			return Config{}, fmt.Errorf("circuit_breaker: drop_percent и volume_multiplier не могут быть отрицательными")
+		}
+		if cb.WindowMinutes <= 0 || cb.VolumeLookback <= 0 || cb.CooldownMinutes <= 0 {
+			return Config{}, fmt.Errorf("circuit_breaker: window_minutes, volume_lookback и cooldown_minutes должны быть положительными")
+		}
+	}
+	if cfg.Schedule.Enabled {
+		if _, err := time.LoadLocation(cfg.Schedule.Timezone); err != nil {
+			return Config{}, fmt.Errorf("schedule: некорректный часовой пояс %q: %w", cfg.Schedule.Timezone, err)
+		}
+		for _, w := range cfg.Schedule.Windows {
+			if _, err := w.Weekdays(); err != nil {
+				return Config{}, fmt.Errorf("schedule: окно %s: %w", w.Name, err)
+			}
+			if _, _, err := w.Minutes(); err != nil {
+				return Config{}, fmt.Errorf("schedule: окно %s: %w", w.Name, err)
+			}
+			if w.ProfitPercent < 0 || w.BaseBuyTimeout < 0 || w.SizeMultiplier < 0 {
+				return Config{}, fmt.Errorf("schedule: окно %s: параметры не могут быть отрицательными", w.Name)
+			}
+		}
+	}
+	if cfg.Shutdown.TimeoutSeconds <= 0 {
+		return Config{}, fmt.Errorf("shutdown: timeout_seconds должен быть положительным")
+	}
+	if cfg.Instance.Enabled {
+		if !regexp.MustCompile(`^[A-Za-z0-9]{1,8}$`).MatchString(cfg.Instance.ClientIDPrefix) {
+			return Config{}, fmt.Errorf("instance: client_id_prefix - от 1 до 8 букв и цифр")
+		}
+		if cfg.Instance.LockFile == "" || cfg.Instance.LookbackMinutes <= 0 {
+			return Config{}, fmt.Errorf("instance: нужны lock_file и положительный lookback_minutes")
+		}
+	}
+	if cfg.DCA.Enabled {
+		if cfg.DCA.BaseOrderSize <= 0 {
+			return Config{}, fmt.Errorf("dca: размер первой покупки должен быть положительным")
+		}
+		if cfg.DCA.SafetyOrders < 0 {
+			return Config{}, fmt.Errorf("dca: количество страховочных ордеров не может быть отрицательным")
+		}
+		if cfg.DCA.SizeMultiplier <= 0 {
+			return Config{}, fmt.Errorf("dca: множитель объёма страховочных ордеров должен быть положительным")
+		}
+		if cfg.DCA.StepPercent <= 0 || cfg.DCA.StepPercent*float64(cfg.DCA.SafetyOrders) >= 100 {
+			return Config{}, fmt.Errorf("dca: некорректный шаг страховочных ордеров")
+		}
+		if cfg.DCA.TakeProfitPercent <= 0 {
+			cfg.DCA.TakeProfitPercent = cfg.ProfitPercent
+		}
+	}
 
 	return cfg, nil
 }
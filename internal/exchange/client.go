@@ -5,6 +5,7 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"github.com/gorilla/websocket"
 	"net/http"
 	"scalpingbot/internal/logger"
@@ -14,13 +15,27 @@ import (
 
 const MaxOpenOrders = 500
 
+// MinNotional - минимальная сумма ордера в USDT
+const MinNotional = 1.0
+
+// ErrBlocked - ордер не пропущен обёрткой биржи (лимиты риска, аварийный выключатель,
+// другой экземпляр бота). Воркеры считают такую ошибку штатной
+var ErrBlocked = errors.New("ордер заблокирован")
+
 // Exchange - интерфейс для работы с биржей
 type Exchange interface {
 	GetPrice(ctx context.Context, symbol string) (float64, error)
+	GetTicker24h(ctx context.Context, symbol string) (*Ticker24h, error)
+	GetBookTicker(ctx context.Context, symbol string) (*BookTicker, error)
+	GetSymbolInfo(ctx context.Context, symbol string) (*SymbolInfo, error)
 	GetAccountInfo(ctx context.Context) (*AccountInfo, error)
+	GetTradeFee(ctx context.Context, symbol string) (*TradeFee, error)
+	GetOrderTrades(ctx context.Context, symbol, orderID string) ([]Trade, error)
 	PlaceOrder(ctx context.Context, req SpotOrderRequest) (*OrderResponse, error)
+	PlaceBatchOrders(ctx context.Context, reqs []SpotOrderRequest) ([]OrderResponse, error)
 	GetAllOrders(ctx context.Context, symbol string, startTime, endTime int64) ([]OrderInfo, error)
 	GetOpenOrders(ctx context.Context, symbol string) ([]OrderInfo, error)
+	GetOrder(ctx context.Context, symbol, orderID, clientOrderID string) (*OrderInfo, error)
 	GetKlines(ctx context.Context, symbol, interval string, limit int) ([]Kline, error)
 	CancelOrder(ctx context.Context, symbol, orderID string) error
 	SubscribeOrderUpdates(ctx context.Context, updateCh chan<- OrderUpdate) error
@@ -38,6 +53,7 @@ type MEXCClient struct {
 	connMu      sync.RWMutex
 	reconnectCh chan struct{}
 	logger      logger.Logger
+	wg          sync.WaitGroup // горутины вебсокета
 }
 
 // NewMEXCClient - конструктор клиента
@@ -56,6 +72,22 @@ func NewMEXCClient(apiKey, secretKey, symbol string, logLogger logger.Logger) *M
 	}
 }
 
+// Wait - ожидание завершения горутин вебсокета после отмены контекста подписки
+func (c *MEXCClient) Wait() {
+	c.wg.Wait()
+}
+
+// throttle - пауза 0.2 сек между запросами (чтобы не было ошибки апи too many requests).
+// При отмене контекста возвращается сразу, ответ биржи уже получен
+func (c *MEXCClient) throttle(ctx context.Context) {
+	timer := time.NewTimer(200 * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
 // sign - генерация HMAC-SHA256 подписи
 func (c *MEXCClient) sign(query string) string {
 	mac := hmac.New(sha256.New, []byte(c.secretKey))
@@ -0,0 +1,119 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// TradeFee — комиссии аккаунта по символу в долях (0.0005 = 0.05%)
+type TradeFee struct {
+	MakerCommission float64 `json:"makerCommission"`
+	TakerCommission float64 `json:"takerCommission"`
+}
+
+// Trade — одна сделка (исполнение) ордера
+type Trade struct {
+	Symbol          string `json:"symbol"`
+	OrderID         string `json:"orderId"`
+	Price           string `json:"price"`
+	Qty             string `json:"qty"`
+	QuoteQty        string `json:"quoteQty"`
+	Commission      string `json:"commission"`
+	CommissionAsset string `json:"commissionAsset"`
+	Time            int64  `json:"time"`
+	IsMaker         bool   `json:"isMaker"`
+}
+
+// GetTradeFee — комиссии maker/taker аккаунта по символу
+func (c *MEXCClient) GetTradeFee(ctx context.Context, symbol string) (*TradeFee, error) {
+	q := url.Values{}
+	q.Set("symbol", symbol)
+	q.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	q.Set("signature", c.sign(q.Encode()))
+
+	body, err := c.signedGet(ctx, "/api/v3/tradeFee", q)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data TradeFee `json:"data"`
+		Code int      `json:"code"`
+		Msg  string   `json:"msg"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("не удалось декодировать ответ: %w, тело: %s", err, string(body))
+	}
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("ошибка API: %d %s", resp.Code, resp.Msg)
+	}
+	return &resp.Data, nil
+}
+
+// TradesPrice - средняя цена исполнений ордера, 0 - исполнений нет
+func TradesPrice(trades []Trade) float64 {
+	var qty, amount float64
+	for _, trade := range trades {
+		tradeQty, _ := strconv.ParseFloat(trade.Qty, 64)
+		quoteQty, _ := strconv.ParseFloat(trade.QuoteQty, 64)
+		qty += tradeQty
+		amount += quoteQty
+	}
+	if qty == 0 {
+		return 0
+	}
+	return amount / qty
+}
+
+// GetOrderTrades — сделки по ордеру с фактическими комиссиями
+func (c *MEXCClient) GetOrderTrades(ctx context.Context, symbol, orderID string) ([]Trade, error) {
+	q := url.Values{}
+	q.Set("symbol", symbol)
+	q.Set("orderId", orderID)
+	q.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	q.Set("signature", c.sign(q.Encode()))
+
+	body, err := c.signedGet(ctx, "/api/v3/myTrades", q)
+	if err != nil {
+		return nil, err
+	}
+
+	var trades []Trade
+	if err := json.Unmarshal(body, &trades); err != nil {
+		return nil, fmt.Errorf("не удалось декодировать ответ: %w, тело: %s", err, string(body))
+	}
+
+	// Задержка для предотвращения превышения лимитов API
+	c.throttle(ctx)
+
+	return trades, nil
+}
+
+// signedGet — GET запрос с подписанными параметрами
+func (c *MEXCClient) signedGet(ctx context.Context, path string, q url.Values) ([]byte, error) {
+	urlEndpoint := fmt.Sprintf("%s%s?%s", c.baseURL, path, q.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", urlEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-MEXC-APIKEY", c.apiKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ошибка API: %s, тело: %s", resp.Status, string(body))
+	}
+	return body, nil
+}
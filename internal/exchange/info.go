@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -45,6 +46,21 @@ func (a *AccountInfo) GetKasBalance() (float64, error) {
 	return 0, nil
 }
 
+// GetTotalBalance возвращает весь баланс валюты: свободный и зарезервированный в ордерах
+func (a *AccountInfo) GetTotalBalance(asset string) (float64, error) {
+	for _, b := range a.Balances {
+		if b.Asset == asset {
+			free, err := strconv.ParseFloat(b.Free, 64)
+			if err != nil {
+				return 0, err
+			}
+			locked, err := strconv.ParseFloat(b.Locked, 64)
+			return free + locked, err
+		}
+	}
+	return 0, nil
+}
+
 // GetAccountInfo — получает информацию о всех балансах аккаунта
 func (c *MEXCClient) GetAccountInfo(ctx context.Context) (*AccountInfo, error) {
 	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
@@ -120,3 +136,172 @@ func (c *MEXCClient) GetPrice(ctx context.Context, symbol string) (float64, erro
 
 	return price, nil
 }
+
+// Ticker24h — статистика символа за 24 часа
+type Ticker24h struct {
+	Symbol    string `json:"symbol"`
+	OpenPrice string `json:"openPrice"`
+	LastPrice string `json:"lastPrice"`
+	HighPrice string `json:"highPrice"`
+	LowPrice  string `json:"lowPrice"`
+	Volume    string `json:"volume"`
+}
+
+// ChangePercent — изменение цены за 24 часа в процентах
+func (t *Ticker24h) ChangePercent() (float64, error) {
+	open, err := strconv.ParseFloat(t.OpenPrice, 64)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось преобразовать openPrice: %w", err)
+	}
+	last, err := strconv.ParseFloat(t.LastPrice, 64)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось преобразовать lastPrice: %w", err)
+	}
+	if open == 0 {
+		return 0, nil
+	}
+	return (last - open) / open * 100, nil
+}
+
+// GetTicker24h — получить статистику символа за 24 часа
+func (c *MEXCClient) GetTicker24h(ctx context.Context, symbol string) (*Ticker24h, error) {
+	urlEndpoint := fmt.Sprintf("%s/api/v3/ticker/24hr?symbol=%s", c.baseURL, symbol)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", urlEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ошибка API: %s, тело: %s", resp.Status, string(body))
+	}
+
+	var ticker Ticker24h
+	if err := json.Unmarshal(body, &ticker); err != nil {
+		return nil, fmt.Errorf("не удалось декодировать ответ: %w, тело: %s", err, string(body))
+	}
+	return &ticker, nil
+}
+
+// SymbolInfo — параметры торговой пары из exchangeInfo
+type SymbolInfo struct {
+	Symbol               string `json:"symbol"`
+	BaseAsset            string `json:"baseAsset"`
+	QuoteAsset           string `json:"quoteAsset"`
+	BaseAssetPrecision   int    `json:"baseAssetPrecision"`   // знаков после запятой в количестве
+	QuotePrecision       int    `json:"quotePrecision"`       // знаков после запятой в цене
+	BaseSizePrecision    string `json:"baseSizePrecision"`    // минимальное количество
+	QuoteAmountPrecision string `json:"quoteAmountPrecision"` // минимальная сумма ордера в quote
+}
+
+// StepSize — шаг количества
+func (s *SymbolInfo) StepSize() float64 {
+	return math.Pow(10, -float64(s.BaseAssetPrecision))
+}
+
+// TickSize — шаг цены
+func (s *SymbolInfo) TickSize() float64 {
+	return math.Pow(10, -float64(s.QuotePrecision))
+}
+
+// MinNotional — минимальная сумма ордера, не меньше MinNotional
+func (s *SymbolInfo) MinNotional() float64 {
+	minNotional, err := strconv.ParseFloat(s.QuoteAmountPrecision, 64)
+	if err != nil || minNotional < MinNotional {
+		return MinNotional
+	}
+	return minNotional
+}
+
+// MinQty — минимальное количество
+func (s *SymbolInfo) MinQty() float64 {
+	minQty, _ := strconv.ParseFloat(s.BaseSizePrecision, 64)
+	return minQty
+}
+
+// GetSymbolInfo — получить параметры торговой пары
+func (c *MEXCClient) GetSymbolInfo(ctx context.Context, symbol string) (*SymbolInfo, error) {
+	urlEndpoint := fmt.Sprintf("%s/api/v3/exchangeInfo?symbol=%s", c.baseURL, symbol)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", urlEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ошибка API: %s, тело: %s", resp.Status, string(body))
+	}
+
+	var info struct {
+		Symbols []SymbolInfo `json:"symbols"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("не удалось декодировать ответ: %w, тело: %s", err, string(body))
+	}
+	for i := range info.Symbols {
+		if info.Symbols[i].Symbol == symbol {
+			return &info.Symbols[i], nil
+		}
+	}
+	return nil, fmt.Errorf("символ %s не найден в exchangeInfo", symbol)
+}
+
+// BookTicker — лучшие цены стакана
+type BookTicker struct {
+	Symbol   string `json:"symbol"`
+	BidPrice string `json:"bidPrice"`
+	BidQty   string `json:"bidQty"`
+	AskPrice string `json:"askPrice"`
+	AskQty   string `json:"askQty"`
+}
+
+// Bid — лучшая цена покупки
+func (t *BookTicker) Bid() (float64, error) {
+	return strconv.ParseFloat(t.BidPrice, 64)
+}
+
+// Ask — лучшая цена продажи
+func (t *BookTicker) Ask() (float64, error) {
+	return strconv.ParseFloat(t.AskPrice, 64)
+}
+
+// GetBookTicker — лучшие bid/ask символа
+func (c *MEXCClient) GetBookTicker(ctx context.Context, symbol string) (*BookTicker, error) {
+	urlEndpoint := fmt.Sprintf("%s/api/v3/ticker/bookTicker?symbol=%s", c.baseURL, symbol)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", urlEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ошибка API: %s, тело: %s", resp.Status, string(body))
+	}
+
+	var ticker BookTicker
+	if err := json.Unmarshal(body, &ticker); err != nil {
+		return nil, fmt.Errorf("не удалось декодировать ответ: %w, тело: %s", err, string(body))
+	}
+	return &ticker, nil
+}
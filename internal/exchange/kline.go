@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,9 +17,22 @@ const (
 	KlineInterval5m  = "5m"
 	KlineInterval15m = "15m"
 	KlineInterval30m = "30m"
-	KlineInterval1h  = "1h"
+	KlineInterval1h  = "60m"
 )
 
+// klineIntervals - интервалы свечей, которые принимает MEXC
+var klineIntervals = []string{"1m", "5m", "15m", "30m", "60m", "4h", "1d", "1W", "1M"}
+
+// ValidKlineInterval - принимает ли биржа интервал свечей
+func ValidKlineInterval(interval string) bool {
+	return slices.Contains(klineIntervals, interval)
+}
+
+// KlineIntervals - допустимые интервалы свечей через запятую, для сообщений об ошибках
+func KlineIntervals() string {
+	return strings.Join(klineIntervals, ", ")
+}
+
 type Kline struct {
 	OpenTime  int64   `json:"-"`
 	Open      float64 `json:"-"`
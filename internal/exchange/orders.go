@@ -3,6 +3,7 @@ package exchange
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -16,7 +17,9 @@ const (
 	Sell = "SELL"
 
 	// типы ордеров
-	Limit = "LIMIT"
+	Limit      = "LIMIT"
+	Market     = "MARKET"
+	LimitMaker = "LIMIT_MAKER" // только maker, отклоняется биржей, если исполнился бы сразу
 
 	// статусы ордеров
 	New             = "NEW"
@@ -24,18 +27,39 @@ const (
 	Filled          = "FILLED"
 )
 
+// ErrOrderNotFound - биржа не знает такой ордер
+var ErrOrderNotFound = errors.New("ордер не найден")
+
+// codeOrderNotFound - код ошибки API "Order does not exist"
+const codeOrderNotFound = -2013
+
 // OrderInfo — структура одного ордера
 type OrderInfo struct {
-	Symbol      string `json:"symbol"`
-	OrderID     string `json:"orderId"`
-	Price       string `json:"price"`
-	OrigQty     string `json:"origQty"`
-	ExecutedQty string `json:"executedQty"`
-	Status      string `json:"status"` // NEW, PARTIALLY_FILLED, FILLED, CANCELED, etc.
-	Type        string `json:"type"`
-	Side        string `json:"side"`
-	Time        int64  `json:"time"`
-	UpdateTime  int64  `json:"updateTime"`
+	Symbol        string `json:"symbol"`
+	OrderID       string `json:"orderId"`
+	Price         string `json:"price"`
+	OrigQty       string `json:"origQty"`
+	ExecutedQty   string `json:"executedQty"`
+	QuoteQty      string `json:"cummulativeQuoteQty"` // исполнено в USDT
+	Status        string `json:"status"`              // NEW, PARTIALLY_FILLED, FILLED, CANCELED, etc.
+	Type          string `json:"type"`
+	Side          string `json:"side"`
+	Time          int64  `json:"time"`
+	UpdateTime    int64  `json:"updateTime"`
+	ClientOrderID string `json:"clientOrderId"`
+}
+
+// FillPrice - средняя цена исполнения: сумма в USDT на исполненный объём.
+// У рыночного ордера цена 0, поэтому цена ордера используется, только если суммы нет.
+// 0 - цену определить не удалось
+func FillPrice(price, qty, quoteQty string) float64 {
+	executed, _ := strconv.ParseFloat(qty, 64)
+	amount, _ := strconv.ParseFloat(quoteQty, 64)
+	if executed > 0 && amount > 0 {
+		return amount / executed
+	}
+	orderPrice, _ := strconv.ParseFloat(price, 64)
+	return max(orderPrice, 0)
 }
 
 // GetAllOrders — получить все ордера по символу
@@ -77,7 +101,7 @@ func (c *MEXCClient) GetAllOrders(ctx context.Context, symbol string, startTime,
 	}
 
 	// спим 0.2 сек
-	time.Sleep(200 * time.Millisecond)
+	c.throttle(ctx)
 
 	return orders, nil
 }
@@ -117,19 +141,71 @@ func (c *MEXCClient) GetOpenOrders(ctx context.Context, symbol string) ([]OrderI
 	}
 
 	// Задержка для предотвращения превышения лимитов API
-	time.Sleep(200 * time.Millisecond)
+	c.throttle(ctx)
 
 	return orders, nil
 }
 
+// GetOrder — ордер по orderID или, если он пустой, по client order ID.
+// ErrOrderNotFound, если ордера нет
+func (c *MEXCClient) GetOrder(ctx context.Context, symbol, orderID, clientOrderID string) (*OrderInfo, error) {
+	q := url.Values{}
+	q.Set("symbol", symbol)
+	if orderID != "" {
+		q.Set("orderId", orderID)
+	} else {
+		q.Set("origClientOrderId", clientOrderID)
+	}
+	q.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+
+	signature := c.sign(q.Encode())
+	q.Set("signature", signature)
+
+	url := fmt.Sprintf("%s/api/v3/order?%s", c.baseURL, q.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-MEXC-APIKEY", c.apiKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Code int `json:"code"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Code == codeOrderNotFound {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("ошибка API: %s, тело: %s", resp.Status, string(body))
+	}
+
+	var order OrderInfo
+	if err := json.Unmarshal(body, &order); err != nil {
+		return nil, fmt.Errorf("не удалось декодировать ответ: %w, тело: %s", err, string(body))
+	}
+
+	// спим 0.2 сек
+	c.throttle(ctx)
+
+	return &order, nil
+}
+
 // SpotOrderRequest - структура для создания ордера через REST API
 type SpotOrderRequest struct {
-	Symbol    string  `json:"symbol"`
-	Side      string  `json:"side"`
-	Type      string  `json:"type"`
-	Quantity  float64 `json:"quantity"`
-	Price     float64 `json:"price,omitempty"`
-	Timestamp int64   `json:"timestamp"`
+	Symbol        string  `json:"symbol"`
+	Side          string  `json:"side"`
+	Type          string  `json:"type"`
+	Quantity      float64 `json:"quantity"`
+	Price         float64 `json:"price,omitempty"`
+	Timestamp     int64   `json:"timestamp"`
+	ClientOrderID string  `json:"newClientOrderId,omitempty"` // пусто - биржа назначит сама
 }
 
 // OrderResponse - ответ от API на создание ордера
@@ -154,7 +230,7 @@ func (c *MEXCClient) PlaceOrder(ctx context.Context, req SpotOrderRequest) (*Ord
 	query.Set("signature", signature)
 
 	urlEndpoint := fmt.Sprintf("%s/api/v3/order?%s", c.baseURL, query.Encode())
-	httpReq, err := http.NewRequest("POST", urlEndpoint, nil)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", urlEndpoint, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -177,11 +253,85 @@ func (c *MEXCClient) PlaceOrder(ctx context.Context, req SpotOrderRequest) (*Ord
 	}
 
 	// спим 0.2 сек (чтобы не было ошибки апи too many requests)
-	time.Sleep(200 * time.Millisecond)
+	c.throttle(ctx)
 
 	return &orderResp, nil
 }
 
+// maxBatchOrders - сколько ордеров принимает batchOrders за один запрос
+const maxBatchOrders = 20
+
+// PlaceBatchOrders - создание нескольких ордеров пачками по 20. Ответы в порядке запросов,
+// у не созданных ордеров пустой OrderID (причина пишется в лог)
+func (c *MEXCClient) PlaceBatchOrders(ctx context.Context, reqs []SpotOrderRequest) ([]OrderResponse, error) {
+	result := make([]OrderResponse, 0, len(reqs))
+	for start := 0; start < len(reqs); start += maxBatchOrders {
+		end := min(start+maxBatchOrders, len(reqs))
+
+		batch := make([]map[string]string, 0, end-start)
+		for _, req := range reqs[start:end] {
+			req.Symbol = c.symbol
+			item := map[string]string{}
+			for key, values := range c.buildOrderQuery(req) {
+				if key != "timestamp" {
+					item[key] = values[0]
+				}
+			}
+			batch = append(batch, item)
+		}
+		batchJSON, err := json.Marshal(batch)
+		if err != nil {
+			return result, err
+		}
+
+		query := url.Values{}
+		query.Set("batchOrders", string(batchJSON))
+		query.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+		query.Set("signature", c.sign(query.Encode()))
+
+		urlEndpoint := fmt.Sprintf("%s/api/v3/batchOrders?%s", c.baseURL, query.Encode())
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", urlEndpoint, nil)
+		if err != nil {
+			return result, err
+		}
+		httpReq.Header.Set("X-MEXC-APIKEY", c.apiKey)
+
+		resp, err := c.client.Do(httpReq)
+		if err != nil {
+			return result, err
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return result, fmt.Errorf("ошибка API: %s, тело: %s", resp.Status, string(body))
+		}
+
+		var items []struct {
+			OrderResponse
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		}
+		if err := json.Unmarshal(body, &items); err != nil {
+			return result, fmt.Errorf("не удалось декодировать ответ PlaceBatchOrders: %w, тело: %s", err, string(body))
+		}
+		for i := start; i < end; i++ {
+			if i-start >= len(items) {
+				result = append(result, OrderResponse{})
+				continue
+			}
+			item := items[i-start]
+			if item.OrderID == "" {
+				c.logger.Error(fmt.Sprintf("Ордер пачки не создан: %d %s", item.Code, item.Msg))
+			}
+			result = append(result, item.OrderResponse)
+		}
+
+		// спим 0.2 сек (чтобы не было ошибки апи too many requests)
+		c.throttle(ctx)
+	}
+	return result, nil
+}
+
 func (c *MEXCClient) CancelOrder(ctx context.Context, symbol, orderID string) error {
 	params := url.Values{}
 	params.Set("symbol", symbol)
@@ -211,7 +361,7 @@ func (c *MEXCClient) CancelOrder(ctx context.Context, symbol, orderID string) er
 	}
 
 	// спим 0.2 сек (чтобы не было ошибки апи too many requests)
-	time.Sleep(200 * time.Millisecond)
+	c.throttle(ctx)
 
 	return nil
 }
@@ -222,9 +372,12 @@ func (c *MEXCClient) buildOrderQuery(req SpotOrderRequest) url.Values {
 	q.Set("side", req.Side)
 	q.Set("type", req.Type)
 	q.Set("quantity", fmt.Sprintf("%.8f", req.Quantity))
-	if req.Type == "LIMIT" {
+	if req.Type == Limit || req.Type == LimitMaker {
 		q.Set("price", fmt.Sprintf("%.8f", req.Price))
 	}
+	if req.ClientOrderID != "" {
+		q.Set("newClientOrderId", req.ClientOrderID)
+	}
 	q.Set("timestamp", strconv.FormatInt(req.Timestamp, 10))
 	return q
 }
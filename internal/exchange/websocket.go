@@ -32,7 +32,9 @@ type OrderUpdate struct {
 	Status  int32
 	//Общее количество (base asset), которое уже исполнено в рамках данного ордера.
 	//В KAS для пары KAS/USDT.
-	Quantity        string
+	Quantity string
+	//Общая сумма (quote asset), на которую исполнен ордер. В USDT для пары KAS/USDT.
+	Amount          string
 	CreateTimestamp int64
 }
 
@@ -47,7 +49,9 @@ func (c *MEXCClient) SubscribeOrderUpdates(ctx context.Context, updateCh chan<-
 	c.ping(ctx)
 
 	// Запускаем горутину для обработки сообщений
+	c.wg.Add(1)
 	go func() {
+		defer c.wg.Done()
 		reconnectTimer := time.NewTimer(reconnectInterval)
 		defer func() {
 			reconnectTimer.Stop()
@@ -155,6 +159,7 @@ func (c *MEXCClient) SubscribeOrderUpdates(ctx context.Context, updateCh chan<-
 						CreateTimestamp: wsMessage.GetPrivateOrders().GetCreateTime(),
 						Status:          wsMessage.GetPrivateOrders().GetStatus(),
 						Quantity:        wsMessage.GetPrivateOrders().GetCumulativeQuantity(),
+						Amount:          wsMessage.GetPrivateOrders().GetCumulativeAmount(),
 					}
 					select {
 					case updateCh <- update:
@@ -179,7 +184,9 @@ func (c *MEXCClient) reconnectMsg() {
 }
 
 func (c *MEXCClient) ping(ctx context.Context) {
+	c.wg.Add(1)
 	go func() {
+		defer c.wg.Done()
 		pingTicker := time.NewTicker(pingInterval)
 		defer pingTicker.Stop()
 		for {
@@ -197,6 +204,12 @@ func (c *MEXCClient) ping(ctx context.Context) {
 				}
 				c.connMu.RUnlock()
 			case <-ctx.Done():
+				// закрываем соединение, чтобы чтение сообщений не ждало дедлайна и горутина завершилась
+				c.connMu.RLock()
+				if c.conn != nil {
+					c.conn.Close()
+				}
+				c.connMu.RUnlock()
 				return
 			}
 		}
@@ -206,7 +219,7 @@ func (c *MEXCClient) ping(ctx context.Context) {
 // ConnectToWebsocket - подключение к WebSocket
 // listenKey протухает каждые 60 минут, поэтому его нужно обновлять
 func (c *MEXCClient) ConnectToWebsocket(ctx context.Context) error {
-	listenKey, err := c.CreateListenKey()
+	listenKey, err := c.CreateListenKey(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create listen key: %w", err)
 	}
@@ -262,13 +275,13 @@ func (c *MEXCClient) ConnectToWebsocket(ctx context.Context) error {
 	return nil
 }
 
-func (c *MEXCClient) CreateListenKey() (string, error) {
+func (c *MEXCClient) CreateListenKey(ctx context.Context) (string, error) {
 	url := c.baseURL + "/api/v3/userDataStream"
 	timestamp := fmt.Sprintf("%d", time.Now().UnixMilli())
 	queryString := fmt.Sprintf("timestamp=%s", timestamp)
 	signature := c.sign(queryString) // Предполагается, что метод sign создает HMAC SHA256 подпись
 
-	req, err := http.NewRequest("POST", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -0,0 +1,128 @@
+// Package fees - комиссии биржи: ставки maker/taker для расчёта цены продажи
+// и фактические комиссии исполнений для журнала позиций
+package fees
+
+import (
+	"context"
+	"log"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/repository"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ratesRefresh - как часто обновлять ставки комиссий аккаунта
+const ratesRefresh = time.Hour
+
+// Tracker - ставки комиссий с кешем и запись фактических комиссий в журнал
+type Tracker struct {
+	cfg      config.Config
+	exchange exchange.Exchange
+	lots     repository.LotRepository
+
+	mu      sync.Mutex
+	rates   *exchange.TradeFee
+	ratesAt time.Time
+}
+
+// NewTracker - конструктор
+func NewTracker(cfg config.Config, ex exchange.Exchange, lots repository.LotRepository) *Tracker {
+	return &Tracker{cfg: cfg, exchange: ex, lots: lots}
+}
+
+// Rates - комиссии покупки и продажи в долях. Покупка по текущей цене считается taker
+// (если не задан buy_side: maker), продажа выше рынка - maker.
+// При ошибке запроса используются maker_percent/taker_percent из конфига
+func (t *Tracker) Rates(ctx context.Context) (float64, float64) {
+	rates := t.tradeFee(ctx)
+	buy := rates.TakerCommission
+	if t.cfg.Fees.BuySide == "maker" {
+		buy = rates.MakerCommission
+	}
+	return buy, rates.MakerCommission
+}
+
+// SellPrice - цена продажи, при которой прибыль после комиссий обеих сторон равна profitPercent
+func (t *Tracker) SellPrice(ctx context.Context, buyPrice, profitPercent float64) float64 {
+	buyFee, sellFee := t.Rates(ctx)
+	return buyPrice * (1 + profitPercent/100) * (1 + buyFee) / (1 - sellFee)
+}
+
+// RecordBuyFee - записывает в журнал фактическую комиссию покупки
+func (t *Tracker) RecordBuyFee(ctx context.Context, buyOrderID string) {
+	fee, err := t.orderFee(ctx, buyOrderID)
+	if err != nil {
+		log.Printf("Ошибка получения комиссии покупки %s: %v", buyOrderID, err)
+		return
+	}
+	if err := t.lots.SetBuyFee(ctx, buyOrderID, fee); err != nil {
+		log.Printf("Ошибка записи комиссии покупки %s в журнал: %v", buyOrderID, err)
+	}
+}
+
+// RecordSellFee - записывает в журнал фактическую комиссию продажи, до закрытия лотов
+func (t *Tracker) RecordSellFee(ctx context.Context, sellOrderID string) {
+	fee, err := t.orderFee(ctx, sellOrderID)
+	if err != nil {
+		log.Printf("Ошибка получения комиссии продажи %s: %v", sellOrderID, err)
+		return
+	}
+	if err := t.lots.SetSellFee(ctx, sellOrderID, fee); err != nil {
+		log.Printf("Ошибка записи комиссии продажи %s в журнал: %v", sellOrderID, err)
+	}
+}
+
+// orderFee - сумма комиссий исполнений ордера в USDT. Комиссия в монете пересчитывается
+// по цене сделки, в другой валюте (например MX) - оценивается по ставке от суммы сделки
+func (t *Tracker) orderFee(ctx context.Context, orderID string) (float64, error) {
+	trades, err := t.exchange.GetOrderTrades(ctx, t.cfg.Symbol, orderID)
+	if err != nil {
+		return 0, err
+	}
+	base := strings.TrimSuffix(t.cfg.Symbol, "USDT")
+	var total float64
+	for _, trade := range trades {
+		commission, _ := strconv.ParseFloat(trade.Commission, 64)
+		price, _ := strconv.ParseFloat(trade.Price, 64)
+		quoteQty, _ := strconv.ParseFloat(trade.QuoteQty, 64)
+		switch trade.CommissionAsset {
+		case "USDT":
+			total += commission
+		case base:
+			total += commission * price
+		default:
+			rates := t.tradeFee(ctx)
+			rate := rates.TakerCommission
+			if trade.IsMaker {
+				rate = rates.MakerCommission
+			}
+			total += quoteQty * rate
+		}
+	}
+	return total, nil
+}
+
+func (t *Tracker) tradeFee(ctx context.Context) exchange.TradeFee {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rates != nil && time.Since(t.ratesAt) < ratesRefresh {
+		return *t.rates
+	}
+	rates, err := t.exchange.GetTradeFee(ctx, t.cfg.Symbol)
+	if err != nil {
+		log.Printf("Ошибка получения комиссий аккаунта: %v", err)
+		if t.rates != nil {
+			return *t.rates
+		}
+		return exchange.TradeFee{
+			MakerCommission: t.cfg.Fees.MakerPercent / 100,
+			TakerCommission: t.cfg.Fees.TakerPercent / 100,
+		}
+	}
+	t.rates = rates
+	t.ratesAt = time.Now()
+	return *t.rates
+}
@@ -0,0 +1,109 @@
+package indicator
+
+import (
+	"math"
+
+	"scalpingbot/internal/exchange"
+)
+
+// Bollinger - полосы Боллинджера: SMA ± k стандартных отклонений
+type Bollinger struct {
+	w     *window
+	sumSq float64
+	k     float64
+}
+
+func NewBollinger(period int, k float64) *Bollinger {
+	return &Bollinger{w: newWindow(period), k: k}
+}
+
+func (b *Bollinger) Update(k exchange.Kline) float64 {
+	old, evicted := b.w.push(k.Close)
+	if evicted {
+		b.sumSq -= old * old
+	}
+	b.sumSq += k.Close * k.Close
+	return b.Value()
+}
+
+// Value - средняя линия
+func (b *Bollinger) Value() float64 {
+	return b.w.mean()
+}
+
+// StdDev - стандартное отклонение за период
+func (b *Bollinger) StdDev() float64 {
+	if b.w.count == 0 {
+		return 0
+	}
+	mean := b.w.mean()
+	variance := b.sumSq/float64(b.w.count) - mean*mean
+	if variance < 0 {
+		// погрешность вычислений на почти постоянных рядах
+		return 0
+	}
+	return math.Sqrt(variance)
+}
+
+func (b *Bollinger) Upper() float64 {
+	return b.Value() + b.k*b.StdDev()
+}
+
+func (b *Bollinger) Lower() float64 {
+	return b.Value() - b.k*b.StdDev()
+}
+
+func (b *Bollinger) Ready() bool {
+	return b.w.full()
+}
+
+// VWAP - средневзвешенная по объёму цена за скользящее окно свечей,
+// period = 0 - накопительно по всем свечам
+type VWAP struct {
+	pv     *window
+	vol    *window
+	sumPV  float64
+	sumVol float64
+	count  int
+	period int
+}
+
+func NewVWAP(period int) *VWAP {
+	v := &VWAP{period: period}
+	if period > 0 {
+		v.pv = newWindow(period)
+		v.vol = newWindow(period)
+	}
+	return v
+}
+
+func (v *VWAP) Update(k exchange.Kline) float64 {
+	typical := (k.High + k.Low + k.Close) / 3
+	v.count++
+	if v.period > 0 {
+		v.pv.push(typical * k.Volume)
+		v.vol.push(k.Volume)
+		return v.Value()
+	}
+	v.sumPV += typical * k.Volume
+	v.sumVol += k.Volume
+	return v.Value()
+}
+
+func (v *VWAP) Value() float64 {
+	sumPV, sumVol := v.sumPV, v.sumVol
+	if v.period > 0 {
+		sumPV, sumVol = v.pv.sum, v.vol.sum
+	}
+	if sumVol == 0 {
+		return 0
+	}
+	return sumPV / sumVol
+}
+
+func (v *VWAP) Ready() bool {
+	if v.period > 0 {
+		return v.count >= v.period
+	}
+	return v.count > 0
+}
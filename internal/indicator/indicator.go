@@ -0,0 +1,65 @@
+// Package indicator - технические индикаторы над exchange.Kline.
+// Каждый индикатор обновляется инкрементально за O(1) на свечу,
+// поэтому стратегии могут пересчитывать их каждые несколько секунд
+package indicator
+
+import "scalpingbot/internal/exchange"
+
+// Indicator - индикатор, обновляемый по закрытым свечам
+type Indicator interface {
+	// Update - добавить закрытую свечу и вернуть новое значение
+	Update(k exchange.Kline) float64
+	// Value - текущее значение
+	Value() float64
+	// Ready - накоплено достаточно свечей для корректного значения
+	Ready() bool
+}
+
+// Compute - прогнать свечи через индикатор и вернуть последнее значение
+func Compute(ind Indicator, klines []exchange.Kline) float64 {
+	for _, k := range klines {
+		ind.Update(k)
+	}
+	return ind.Value()
+}
+
+// window - кольцевой буфер фиксированного размера с суммой значений
+type window struct {
+	values []float64
+	index  int
+	count  int
+	sum    float64
+}
+
+func newWindow(size int) *window {
+	if size < 1 {
+		size = 1
+	}
+	return &window{values: make([]float64, size)}
+}
+
+// push - добавляет значение и возвращает вытесненное (если окно было заполнено)
+func (w *window) push(v float64) (float64, bool) {
+	old := w.values[w.index]
+	full := w.count == len(w.values)
+	if full {
+		w.sum -= old
+	} else {
+		w.count++
+	}
+	w.values[w.index] = v
+	w.sum += v
+	w.index = (w.index + 1) % len(w.values)
+	return old, full
+}
+
+func (w *window) full() bool {
+	return w.count == len(w.values)
+}
+
+func (w *window) mean() float64 {
+	if w.count == 0 {
+		return 0
+	}
+	return w.sum / float64(w.count)
+}
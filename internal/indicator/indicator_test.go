@@ -0,0 +1,166 @@
+package indicator
+
+import (
+	"math"
+	"testing"
+
+	"scalpingbot/internal/exchange"
+)
+
+// closes - свечи, у которых задана только цена закрытия
+func closes(values ...float64) []exchange.Kline {
+	klines := make([]exchange.Kline, len(values))
+	for i, v := range values {
+		klines[i] = exchange.Kline{OpenTime: int64(i), Open: v, High: v, Low: v, Close: v}
+	}
+	return klines
+}
+
+func almostEqual(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+// Пример расчёта RSI(14) Уайлдера из StockCharts: первое значение после 14 изменений
+// по простому среднему, дальше сглаживание (avg*(n-1) + x) / n
+func TestRSIWilder(t *testing.T) {
+	klines := closes(44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+		45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64)
+
+	tests := []struct {
+		candles int
+		ready   bool
+		want    float64
+	}{
+		{candles: 1, ready: false, want: 50},
+		{candles: 14, ready: false, want: 50},
+		{candles: 15, ready: true, want: 70.4641},
+		{candles: 16, ready: true, want: 66.2496},
+		{candles: 17, ready: true, want: 66.4809},
+		{candles: 18, ready: true, want: 69.3469},
+		{candles: 19, ready: true, want: 66.2947},
+		{candles: 20, ready: true, want: 57.9150},
+	}
+	for _, tt := range tests {
+		rsi := NewRSI(14)
+		got := Compute(rsi, klines[:tt.candles])
+		if rsi.Ready() != tt.ready {
+			t.Errorf("свечей %d: Ready() = %v, ожидалось %v", tt.candles, rsi.Ready(), tt.ready)
+		}
+		if !almostEqual(got, tt.want, 1e-4) {
+			t.Errorf("свечей %d: RSI = %.4f, ожидалось %.4f", tt.candles, got, tt.want)
+		}
+	}
+}
+
+func TestRSIFlat(t *testing.T) {
+	tests := []struct {
+		name   string
+		klines []exchange.Kline
+		want   float64
+	}{
+		{name: "без изменений", klines: closes(10, 10, 10, 10), want: 50},
+		{name: "только рост", klines: closes(10, 11, 12, 13), want: 100},
+		{name: "только падение", klines: closes(13, 12, 11, 10), want: 0},
+	}
+	for _, tt := range tests {
+		if got := Compute(NewRSI(3), tt.klines); !almostEqual(got, tt.want, 1e-9) {
+			t.Errorf("%s: RSI = %.4f, ожидалось %.4f", tt.name, got, tt.want)
+		}
+	}
+}
+
+// ATR(3): истинный диапазон считается от второй свечи, первое значение - среднее трёх TR,
+// дальше сглаживание Уайлдера. TR: 2, 2, 3, затем гэп вниз от 13 до 7 даёт 6
+func TestATRWilder(t *testing.T) {
+	klines := []exchange.Kline{
+		{High: 10, Low: 8, Close: 9},
+		{High: 11, Low: 9, Close: 10},
+		{High: 12, Low: 10, Close: 11},
+		{High: 14, Low: 11, Close: 13},
+		{High: 9, Low: 7, Close: 8},
+	}
+
+	tests := []struct {
+		candles int
+		ready   bool
+		want    float64
+	}{
+		{candles: 1, ready: false, want: 0},
+		{candles: 3, ready: false, want: 0},
+		{candles: 4, ready: true, want: 7.0 / 3},
+		{candles: 5, ready: true, want: (7.0/3*2 + 6) / 3},
+	}
+	for _, tt := range tests {
+		atr := NewATR(3)
+		got := Compute(atr, klines[:tt.candles])
+		if atr.Ready() != tt.ready {
+			t.Errorf("свечей %d: Ready() = %v, ожидалось %v", tt.candles, atr.Ready(), tt.ready)
+		}
+		if !almostEqual(got, tt.want, 1e-9) {
+			t.Errorf("свечей %d: ATR = %.6f, ожидалось %.6f", tt.candles, got, tt.want)
+		}
+	}
+}
+
+// EMA начинается с SMA за period свечей
+func TestEMASeed(t *testing.T) {
+	klines := closes(10, 11, 12, 11, 13)
+
+	tests := []struct {
+		candles int
+		ready   bool
+		want    float64
+	}{
+		{candles: 1, ready: false, want: 10},
+		{candles: 2, ready: false, want: 10.5},
+		{candles: 3, ready: true, want: 11},
+		{candles: 4, ready: true, want: 11},
+		{candles: 5, ready: true, want: 12},
+	}
+	for _, tt := range tests {
+		ema := NewEMA(3)
+		got := Compute(ema, klines[:tt.candles])
+		if ema.Ready() != tt.ready {
+			t.Errorf("свечей %d: Ready() = %v, ожидалось %v", tt.candles, ema.Ready(), tt.ready)
+		}
+		if !almostEqual(got, tt.want, 1e-9) {
+			t.Errorf("свечей %d: EMA = %.6f, ожидалось %.6f", tt.candles, got, tt.want)
+		}
+	}
+}
+
+// MACD(3,5,2): линия появляется, когда готова медленная EMA (5-я свеча), сигнальная
+// линия считается только по значениям линии и готова со следующей свечи
+func TestMACDSignalStart(t *testing.T) {
+	klines := closes(10, 11, 12, 11, 13, 14, 13, 15, 16, 15)
+
+	tests := []struct {
+		candles int
+		ready   bool
+		line    float64
+		signal  float64
+	}{
+		{candles: 4, ready: false, line: 0, signal: 0},
+		{candles: 5, ready: false, line: 0.6, signal: 0.6},
+		{candles: 6, ready: true, line: 0.733333, signal: 0.666667},
+		{candles: 7, ready: true, line: 0.488889, signal: 0.548148},
+		{candles: 8, ready: true, line: 0.659259, signal: 0.622222},
+		{candles: 10, ready: true, line: 0.515226, signal: 0.584362},
+	}
+	for _, tt := range tests {
+		macd := NewMACD(3, 5, 2)
+		Compute(macd, klines[:tt.candles])
+		if macd.Ready() != tt.ready {
+			t.Errorf("свечей %d: Ready() = %v, ожидалось %v", tt.candles, macd.Ready(), tt.ready)
+		}
+		if !almostEqual(macd.Value(), tt.line, 1e-6) {
+			t.Errorf("свечей %d: MACD = %.6f, ожидалось %.6f", tt.candles, macd.Value(), tt.line)
+		}
+		if !almostEqual(macd.Signal(), tt.signal, 1e-6) {
+			t.Errorf("свечей %d: сигнальная = %.6f, ожидалось %.6f", tt.candles, macd.Signal(), tt.signal)
+		}
+		if !almostEqual(macd.Histogram(), tt.line-tt.signal, 1e-6) {
+			t.Errorf("свечей %d: гистограмма = %.6f, ожидалось %.6f", tt.candles, macd.Histogram(), tt.line-tt.signal)
+		}
+	}
+}
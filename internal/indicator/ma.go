@@ -0,0 +1,92 @@
+package indicator
+
+import "scalpingbot/internal/exchange"
+
+// SMA - простая скользящая средняя по цене закрытия
+type SMA struct {
+	w *window
+}
+
+func NewSMA(period int) *SMA {
+	return &SMA{w: newWindow(period)}
+}
+
+func (s *SMA) Update(k exchange.Kline) float64 {
+	return s.Add(k.Close)
+}
+
+// Add - добавить произвольное значение (для индикаторов поверх других рядов)
+func (s *SMA) Add(v float64) float64 {
+	s.w.push(v)
+	return s.Value()
+}
+
+func (s *SMA) Value() float64 {
+	return s.w.mean()
+}
+
+func (s *SMA) Ready() bool {
+	return s.w.full()
+}
+
+// EMA - экспоненциальная скользящая средняя по цене закрытия.
+// Первое значение - SMA за period свечей
+type EMA struct {
+	period int
+	alpha  float64
+	count  int
+	sum    float64
+	value  float64
+}
+
+func NewEMA(period int) *EMA {
+	if period < 1 {
+		period = 1
+	}
+	return &EMA{period: period, alpha: 2 / float64(period+1)}
+}
+
+func (e *EMA) Update(k exchange.Kline) float64 {
+	return e.Add(k.Close)
+}
+
+// Add - добавить произвольное значение (для индикаторов поверх других рядов)
+func (e *EMA) Add(v float64) float64 {
+	e.count++
+	if e.count <= e.period {
+		e.sum += v
+		e.value = e.sum / float64(e.count)
+		return e.value
+	}
+	e.value += e.alpha * (v - e.value)
+	return e.value
+}
+
+func (e *EMA) Value() float64 {
+	return e.value
+}
+
+func (e *EMA) Ready() bool {
+	return e.count >= e.period
+}
+
+// VolumeMA - простая скользящая средняя объёма
+type VolumeMA struct {
+	sma *SMA
+}
+
+func NewVolumeMA(period int) *VolumeMA {
+	return &VolumeMA{sma: NewSMA(period)}
+}
+
+func (v *VolumeMA) Update(k exchange.Kline) float64 {
+	return v.sma.Add(k.Volume)
+}
+
+func (v *VolumeMA) Value() float64 {
+	return v.sma.Value()
+}
+
+func (v *VolumeMA) Ready() bool {
+	return v.sma.Ready()
+}
@@ -0,0 +1,152 @@
+package indicator
+
+import (
+	"math"
+
+	"scalpingbot/internal/exchange"
+)
+
+// RSI - индекс относительной силы со сглаживанием Уайлдера
+type RSI struct {
+	period    int
+	count     int
+	prevClose float64
+	avgGain   float64
+	avgLoss   float64
+}
+
+func NewRSI(period int) *RSI {
+	if period < 1 {
+		period = 1
+	}
+	return &RSI{period: period}
+}
+
+func (r *RSI) Update(k exchange.Kline) float64 {
+	if r.count == 0 {
+		r.prevClose = k.Close
+		r.count++
+		return r.Value()
+	}
+
+	change := k.Close - r.prevClose
+	r.prevClose = k.Close
+	gain, loss := math.Max(change, 0), math.Max(-change, 0)
+
+	n := float64(r.period)
+	if r.count <= r.period {
+		// первые period изменений - простое среднее
+		r.avgGain += gain / n
+		r.avgLoss += loss / n
+	} else {
+		r.avgGain = (r.avgGain*(n-1) + gain) / n
+		r.avgLoss = (r.avgLoss*(n-1) + loss) / n
+	}
+	r.count++
+	return r.Value()
+}
+
+func (r *RSI) Value() float64 {
+	if !r.Ready() {
+		return 50
+	}
+	if r.avgLoss == 0 {
+		if r.avgGain == 0 {
+			return 50
+		}
+		return 100
+	}
+	rs := r.avgGain / r.avgLoss
+	return 100 - 100/(1+rs)
+}
+
+func (r *RSI) Ready() bool {
+	return r.count > r.period
+}
+
+// ATR - средний истинный диапазон по Уайлдеру
+type ATR struct {
+	period    int
+	count     int
+	prevClose float64
+	value     float64
+}
+
+func NewATR(period int) *ATR {
+	if period < 1 {
+		period = 1
+	}
+	return &ATR{period: period}
+}
+
+func (a *ATR) Update(k exchange.Kline) float64 {
+	if a.count == 0 {
+		a.prevClose = k.Close
+		a.count++
+		return 0
+	}
+
+	tr := math.Max(k.High-k.Low, math.Max(math.Abs(k.High-a.prevClose), math.Abs(k.Low-a.prevClose)))
+	a.prevClose = k.Close
+
+	n := float64(a.period)
+	if a.count <= a.period {
+		a.value += tr / n
+	} else {
+		a.value = (a.value*(n-1) + tr) / n
+	}
+	a.count++
+	return a.Value()
+}
+
+func (a *ATR) Value() float64 {
+	if !a.Ready() {
+		return 0
+	}
+	return a.value
+}
+
+func (a *ATR) Ready() bool {
+	return a.count > a.period
+}
+
+// MACD - разница быстрой и медленной EMA и сигнальная линия
+type MACD struct {
+	fast   *EMA
+	slow   *EMA
+	signal *EMA
+	line   float64
+}
+
+func NewMACD(fast, slow, signal int) *MACD {
+	return &MACD{fast: NewEMA(fast), slow: NewEMA(slow), signal: NewEMA(signal)}
+}
+
+func (m *MACD) Update(k exchange.Kline) float64 {
+	m.fast.Update(k)
+	m.slow.Update(k)
+	if m.slow.Ready() {
+		m.line = m.fast.Value() - m.slow.Value()
+		m.signal.Add(m.line)
+	}
+	return m.line
+}
+
+// Value - линия MACD
+func (m *MACD) Value() float64 {
+	return m.line
+}
+
+// Signal - сигнальная линия
+func (m *MACD) Signal() float64 {
+	return m.signal.Value()
+}
+
+// Histogram - гистограмма MACD
+func (m *MACD) Histogram() float64 {
+	return m.line - m.signal.Value()
+}
+
+func (m *MACD) Ready() bool {
+	return m.slow.Ready() && m.signal.Ready()
+}
@@ -0,0 +1,40 @@
+package indicator
+
+import "scalpingbot/internal/exchange"
+
+// Series - подаёт в индикаторы только новые закрытые свечи из периодически
+// запрашиваемого GetKlines, уже учтённые свечи пропускаются
+type Series struct {
+	indicators   []Indicator
+	lastOpenTime int64
+}
+
+func NewSeries(indicators ...Indicator) *Series {
+	return &Series{indicators: indicators}
+}
+
+// Add - подключить индикатор (до первого Feed)
+func (s *Series) Add(ind Indicator) {
+	s.indicators = append(s.indicators, ind)
+}
+
+// Feed - обновить индикаторы новыми свечами, возвращает количество новых свечей
+func (s *Series) Feed(klines []exchange.Kline) int {
+	added := 0
+	for _, k := range klines {
+		if k.OpenTime <= s.lastOpenTime {
+			continue
+		}
+		for _, ind := range s.indicators {
+			ind.Update(k)
+		}
+		s.lastOpenTime = k.OpenTime
+		added++
+	}
+	return added
+}
+
+// LastOpenTime - время открытия последней учтённой свечи
+func (s *Series) LastOpenTime() int64 {
+	return s.lastOpenTime
+}
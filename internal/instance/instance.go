@@ -0,0 +1,241 @@
+// Package instance - защита от двух копий бота на одном API ключе: локальный lock файл
+// и метка экземпляра в client order ID, по которой видны ордера другой копии на бирже
+package instance
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// FileLock - эксклюзивная блокировка lock файла. Снимается системой при завершении процесса
+type FileLock struct {
+	file       *os.File
+	previousID string
+}
+
+// AcquireFileLock - блокирует lock файл и записывает в него ID экземпляра.
+// Ошибка, если файл заблокирован другим запущенным ботом
+func AcquireFileLock(path, id string) (*FileLock, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("lock файл %s занят другим запущенным ботом: %w", path, err)
+	}
+
+	// ID прошлого запуска на этой машине: его ордера на бирже - не чужие
+	previous := make([]byte, 64)
+	n, _ := file.ReadAt(previous, 0)
+	lock := &FileLock{file: file, previousID: strings.TrimSpace(string(previous[:n]))}
+
+	if err := file.Truncate(0); err != nil {
+		lock.Release()
+		return nil, err
+	}
+	if _, err := file.WriteAt([]byte(id+"\n"), 0); err != nil {
+		lock.Release()
+		return nil, err
+	}
+	return lock, nil
+}
+
+// PreviousID - ID экземпляра прошлого запуска из lock файла
+func (l *FileLock) PreviousID() string {
+	return l.previousID
+}
+
+// Release - снимает блокировку. ID остаётся в файле для следующего запуска
+func (l *FileLock) Release() {
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	l.file.Close()
+}
+
+// NewID - случайный ID экземпляра
+func NewID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Monitor - метка экземпляра в client order ID и поиск ордеров другой копии бота
+type Monitor struct {
+	cfg        config.Config
+	exchange   exchange.Exchange
+	logger     logger.Logger
+	id         string
+	previousID string
+	startedAt  time.Time
+	seq        atomic.Int64
+
+	mu       sync.Mutex
+	conflict string // ID другого экземпляра, пусто - конфликта нет
+}
+
+// NewMonitor - конструктор. ex - биржа без обёртки
+func NewMonitor(cfg config.Config, ex exchange.Exchange, id, previousID string, logLogger logger.Logger) *Monitor {
+	return &Monitor{
+		cfg:        cfg,
+		exchange:   ex,
+		logger:     logLogger,
+		id:         id,
+		previousID: previousID,
+		startedAt:  time.Now(),
+	}
+}
+
+// CheckStartup - ID другого экземпляра с ордерами за lookback_minutes до запуска.
+// Ордера прошлого запуска с этой машины не считаются
+func (m *Monitor) CheckStartup(ctx context.Context) (string, error) {
+	since := m.startedAt.Add(-time.Duration(m.cfg.Instance.LookbackMinutes) * time.Minute)
+	return m.foreign(ctx, since, m.previousID)
+}
+
+// Process - периодический поиск ордеров другого экземпляра, созданных после запуска.
+// Пока они есть, покупки запрещены
+func (m *Monitor) Process(ctx context.Context) error {
+	since := time.Now().Add(-time.Duration(m.cfg.Instance.LookbackMinutes) * time.Minute)
+	if since.Before(m.startedAt) {
+		since = m.startedAt
+	}
+	other, err := m.foreign(ctx, since, "")
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	previous := m.conflict
+	m.conflict = other
+	m.mu.Unlock()
+
+	switch {
+	case other != "" && previous == "":
+		msg := fmt.Sprintf("Обнаружен другой экземпляр бота %s на этом API ключе, покупки остановлены", other)
+		log.Print(msg)
+		m.logger.Notify(msg)
+	case other == "" && previous != "":
+		msg := fmt.Sprintf("Ордеров экземпляра %s больше нет, покупки возобновлены", previous)
+		log.Print(msg)
+		m.logger.Notify(msg)
+	}
+	return nil
+}
+
+func (m *Monitor) Name() string {
+	return "instance"
+}
+
+// Conflict - ID другого экземпляра, если он обнаружен
+func (m *Monitor) Conflict() (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conflict, m.conflict != ""
+}
+
+// ClientOrderID - новый client order ID с меткой экземпляра: <prefix>-<id>-<время><номер>
+func (m *Monitor) ClientOrderID() string {
+	return fmt.Sprintf("%s-%s-%s%d", m.cfg.Instance.ClientIDPrefix, m.id,
+		strconv.FormatInt(time.Now().UnixMilli(), 36), m.seq.Add(1))
+}
+
+// foreign - ID экземпляра, отличного от текущего и ignoreID, с ордерами начиная с since
+func (m *Monitor) foreign(ctx context.Context, since time.Time, ignoreID string) (string, error) {
+	orders, err := m.exchange.GetAllOrders(ctx, m.cfg.Symbol, since.UnixMilli(), time.Now().UnixMilli())
+	if err != nil {
+		return "", err
+	}
+	for _, order := range orders {
+		if order.Time < since.UnixMilli() {
+			continue
+		}
+		id := m.instanceID(order.ClientOrderID)
+		if id != "" && id != m.id && id != ignoreID {
+			return id, nil
+		}
+	}
+	return "", nil
+}
+
+// instanceID - ID экземпляра из client order ID, пусто - ордер не бота
+func (m *Monitor) instanceID(clientOrderID string) string {
+	rest, ok := strings.CutPrefix(clientOrderID, m.cfg.Instance.ClientIDPrefix+"-")
+	if !ok {
+		return ""
+	}
+	id, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return ""
+	}
+	return id
+}
+
+// Guard - биржа, которая ставит метку экземпляра на каждый ордер
+// и не пропускает покупки, пока работает другой экземпляр
+type Guard struct {
+	exchange.Exchange
+	monitor *Monitor
+}
+
+// NewGuard - обёртка над биржей
+func NewGuard(ex exchange.Exchange, monitor *Monitor) *Guard {
+	return &Guard{Exchange: ex, monitor: monitor}
+}
+
+// PlaceOrder - размещение ордера с меткой экземпляра
+func (g *Guard) PlaceOrder(ctx context.Context, req exchange.SpotOrderRequest) (*exchange.OrderResponse, error) {
+	if err := g.check(req); err != nil {
+		return nil, err
+	}
+	if req.ClientOrderID == "" {
+		req.ClientOrderID = g.monitor.ClientOrderID()
+	}
+	return g.Exchange.PlaceOrder(ctx, req)
+}
+
+// PlaceBatchOrders - размещение пачки ордеров с меткой экземпляра
+func (g *Guard) PlaceBatchOrders(ctx context.Context, reqs []exchange.SpotOrderRequest) ([]exchange.OrderResponse, error) {
+	marked := make([]exchange.SpotOrderRequest, 0, len(reqs))
+	for _, req := range reqs {
+		if err := g.check(req); err != nil {
+			return nil, err
+		}
+		if req.ClientOrderID == "" {
+			req.ClientOrderID = g.monitor.ClientOrderID()
+		}
+		marked = append(marked, req)
+	}
+	return g.Exchange.PlaceBatchOrders(ctx, marked)
+}
+
+func (g *Guard) check(req exchange.SpotOrderRequest) error {
+	if req.Side != exchange.Buy {
+		return nil
+	}
+	if other, ok := g.monitor.Conflict(); ok {
+		log.Printf("Покупка заблокирована: работает другой экземпляр бота %s", other)
+		return fmt.Errorf("%w: другой экземпляр бота %s", exchange.ErrBlocked, other)
+	}
+	return nil
+}
@@ -2,37 +2,58 @@ package listener
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"scalpingbot/internal/config"
 	"scalpingbot/internal/exchange"
 	"scalpingbot/internal/logger"
 	"scalpingbot/internal/repo"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/takeprofit"
 	"strconv"
 	"sync"
 )
 
+// UpdateHandler - дополнительный обработчик обновлений ордеров (например, сеточная стратегия)
+type UpdateHandler interface {
+	HandleUpdate(ctx context.Context, update exchange.OrderUpdate)
+}
+
 // OrderListener - компонент для обработки обновлений ордеров
 type OrderListener struct {
-	cfg      config.Config
-	exchange exchange.Exchange
-	updateCh <-chan exchange.OrderUpdate
-	logger   logger.Logger
-	storage  repo.Repo
-	wg       sync.WaitGroup
+	cfg       config.Config
+	exchange  exchange.Exchange
+	updateCh  <-chan exchange.OrderUpdate
+	logger    logger.Logger
+	orders    repo.OrderStateRepo
+	positions repo.PositionRepo
+	lots      repository.LotRepository
+	placer    *takeprofit.Placer
+	handlers  []UpdateHandler
+	wg        sync.WaitGroup
 }
 
 // NewOrderListener - конструктор листенера
-func NewOrderListener(cfg config.Config, ex exchange.Exchange, updateCh <-chan exchange.OrderUpdate, logLogger logger.Logger, storage repo.Repo) *OrderListener {
+func NewOrderListener(cfg config.Config, ex exchange.Exchange, updateCh <-chan exchange.OrderUpdate, logLogger logger.Logger,
+	orders repo.OrderStateRepo, positions repo.PositionRepo, lots repository.LotRepository, placer *takeprofit.Placer) *OrderListener {
 	return &OrderListener{
-		cfg:      cfg,
-		exchange: ex,
-		updateCh: updateCh,
-		logger:   logLogger,
-		storage:  storage,
+		cfg:       cfg,
+		exchange:  ex,
+		updateCh:  updateCh,
+		logger:    logLogger,
+		orders:    orders,
+		positions: positions,
+		lots:      lots,
+		placer:    placer,
 	}
 }
 
+// AddHandler - регистрация дополнительного обработчика, вызывать до Start
+func (l *OrderListener) AddHandler(h UpdateHandler) {
+	l.handlers = append(l.handlers, h)
+}
+
 // Start - запуск обработки сообщений
 func (l *OrderListener) Start(ctx context.Context) {
 	l.wg.Add(1)
@@ -50,6 +71,9 @@ func (l *OrderListener) Start(ctx context.Context) {
 					return
 				}
 				l.processUpdate(ctx, update)
+				for _, h := range l.handlers {
+					h.HandleUpdate(ctx, update)
+				}
 			}
 		}
 	}()
@@ -57,40 +81,77 @@ func (l *OrderListener) Start(ctx context.Context) {
 
 // processUpdate - обработка одного обновления
 func (l *OrderListener) processUpdate(ctx context.Context, update exchange.OrderUpdate) {
-	if l.storage.Has(update.OrderId) && update.Status == exchange.FullyTraded {
-		// Логирование ордера
-		l.logger.Info(fmt.Sprintf("New order full update: OrderId=%s, Price=%s, Quantity=%s Status=%d",
-			update.OrderId, update.Price, update.Quantity, update.Status))
-
-		newPrice, err := strconv.ParseFloat(update.Price, 64)
-		if err != nil {
-			log.Printf("Error parsing price: %v", err)
-			l.logger.Error(fmt.Sprintf("Error parsing price: %v", err))
-			return
-		}
-		newPrice = newPrice * (1 + l.cfg.ProfitPercent/100)
-		qty, err := strconv.ParseFloat(update.Quantity, 64)
-		if err != nil {
-			log.Printf("Error parsing quantity: %v", err)
-			l.logger.Error(fmt.Sprintf("Error parsing quantity: %v", err))
-			return
-		}
-		sellOrder := exchange.SpotOrderRequest{
-			Symbol:   l.cfg.Symbol,
-			Side:     exchange.Sell,
-			Type:     exchange.Limit,
-			Quantity: qty,
-			Price:    newPrice,
-		}
-		orderResp, err := l.exchange.PlaceOrder(ctx, sellOrder)
-		if err != nil {
-			log.Printf("Error placing sell order: %v", err)
-			l.logger.Error(fmt.Sprintf("Error placing sell order: %v", err))
-			return
+	// Покупки бота в любом состоянии, в том числе уже закрытые: поздние обновления по ним - не продажи
+	if _, ok := l.orders.Get(update.OrderId); ok {
+		switch update.Status {
+		case exchange.PartiallyTraded:
+			// Покупка ещё стоит, продаём исполненную часть и ждём остальное
+			if l.orders.Transition(update.OrderId, repo.OrderPartial, repo.OrderNew, repo.OrderPartial) {
+				l.sellExecuted(ctx, update, l.placer.SellExecuted)
+			}
+		case exchange.FullyTraded, exchange.PartiallyCanceled:
+			// Если продажа не разместилась, покупка остаётся в FILLED и её продаст sell_v1
+			l.sellExecuted(ctx, update, l.placer.SellFilled)
+		case exchange.Canceled:
+			if !l.orders.Transition(update.OrderId, repo.OrderCanceled, repo.OrderNew, repo.OrderPartial) {
+				return
+			}
+			if err := l.lots.MarkBuyCanceled(ctx, update.OrderId); err != nil {
+				log.Printf("Ошибка записи отмены покупки %s в журнал: %v", update.OrderId, err)
+			}
 		}
+		return
+	}
+
+	// Исполнен тейк-профит - позиция закрыта
+	if update.Status == exchange.FullyTraded {
+		l.positions.Remove(update.OrderId)
+		l.closeLots(ctx, update)
+	}
+}
+
+// sellFunc - размещение тейк-профита плейсером
+type sellFunc func(ctx context.Context, buyOrderID string, buyPrice, executedQty float64) (*exchange.OrderResponse, error)
+
+// sellExecuted - тейк-профит на исполненный и ещё не проданный объём покупки
+func (l *OrderListener) sellExecuted(ctx context.Context, update exchange.OrderUpdate, sell sellFunc) {
+	// Логирование ордера
+	l.logger.Info(fmt.Sprintf("New order update: OrderId=%s, Price=%s, Quantity=%s Status=%d",
+		update.OrderId, update.Price, update.Quantity, update.Status))
+
+	buyPrice, err := strconv.ParseFloat(update.Price, 64)
+	if err != nil {
+		log.Printf("Error parsing price: %v", err)
+		l.logger.Error(fmt.Sprintf("Error parsing price: %v", err))
+		return
+	}
+	qty, err := strconv.ParseFloat(update.Quantity, 64)
+	if err != nil {
+		log.Printf("Error parsing quantity: %v", err)
+		l.logger.Error(fmt.Sprintf("Error parsing quantity: %v", err))
+		return
+	}
+	orderResp, err := sell(ctx, update.OrderId, buyPrice, qty)
+	if err != nil {
+		log.Printf("Error placing sell order: %v", err)
+		l.logger.Error(fmt.Sprintf("Error placing sell order: %v", err))
+		return
+	}
+	if orderResp != nil {
 		log.Printf("Ордер в лиснере на продажу размещен: %s oldPrice=%s newPrice=%s", orderResp.OrderID, update.Price, orderResp.Price)
-		// Удаляем старый бай ордер из стораджа
-		l.storage.Remove(update.OrderId)
+	}
+}
+
+// closeLots - закрытие лотов журнала по исполненной продаже
+func (l *OrderListener) closeLots(ctx context.Context, update exchange.OrderUpdate) {
+	price := exchange.FillPrice(update.Price, update.Quantity, update.Amount)
+	qty, err := strconv.ParseFloat(update.Quantity, 64)
+	if err != nil {
+		return
+	}
+	err = l.placer.CloseSell(ctx, update.OrderId, price, qty)
+	if err != nil && !errors.Is(err, repository.ErrLotNotFound) {
+		l.logger.Error(fmt.Sprintf("Ошибка закрытия лота по продаже %s: %v", update.OrderId, err))
 	}
 }
 
@@ -18,6 +18,8 @@ type Logger interface {
 	Warn(msg string)
 	Error(msg string)
 	Fatal(msg string)
+	// Notify - информационное сообщение, которое дублируется в Telegram
+	Notify(msg string)
 }
 
 type TelegramLogger struct {
@@ -146,3 +148,10 @@ func (l *logrusLogger) Error(msg string) {
 func (l *logrusLogger) Fatal(msg string) {
 	l.logger.Fatal(msg)
 }
+
+func (l *logrusLogger) Notify(msg string) {
+	l.logger.Info(msg)
+	if err := l.telegram.SendMessage(msg); err != nil {
+		l.logger.Warn(fmt.Sprintf("Ошибка отправки уведомления в Telegram: %v", err))
+	}
+}
@@ -0,0 +1,433 @@
+// Package outbox - журнал намерений: продажи, покупки, ордера воркеров и отмены записываются в базу
+// до отправки на биржу и отмечаются выполненными после ответа. Если процесс упал между
+// отправкой и записью в журнал лотов, Replayer при запуске по client order ID выясняет,
+// дошёл ли ордер до биржи, и доводит намерение до конца без повторного ордера
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/logger"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/tools"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// retention - сколько хранить выполненные и отклонённые намерения
+const retention = 7 * 24 * time.Hour
+
+// Outbox - отправка ордеров через журнал намерений
+type Outbox struct {
+	cfg        config.Config
+	exchange   exchange.Exchange
+	repo       repository.OutboxRepository
+	instanceID string
+}
+
+// New - конструктор. instanceID входит в client order ID, как у остальных ордеров бота
+func New(cfg config.Config, ex exchange.Exchange, repo repository.OutboxRepository, instanceID string) *Outbox {
+	return &Outbox{
+		cfg:        cfg,
+		exchange:   ex,
+		repo:       repo,
+		instanceID: instanceID,
+	}
+}
+
+// PlaceSell - продажа для покупки buyOrderID. Возвращает ID намерения: его нужно отметить
+// через Done после записи продажи в журнал лотов, иначе при запуске его разберёт Replayer
+func (o *Outbox) PlaceSell(ctx context.Context, buyOrderID string, buyPrice float64, req exchange.SpotOrderRequest) (int64, *exchange.OrderResponse, error) {
+	return o.placeOne(ctx, repository.Intent{
+		Kind:       repository.IntentSell,
+		BuyOrderID: buyOrderID,
+		BuyPrice:   buyPrice,
+	}, req)
+}
+
+// ReplaceSell - продажа взамен уже снятой продажи oldSellOrderID (выход по стопу или трейлингу).
+// После переноса лотов на новую продажу намерение отмечается через Done
+func (o *Outbox) ReplaceSell(ctx context.Context, oldSellOrderID string, req exchange.SpotOrderRequest) (int64, *exchange.OrderResponse, error) {
+	return o.placeOne(ctx, repository.Intent{Kind: repository.IntentReplace, OrderID: oldSellOrderID}, req)
+}
+
+// ReplaceSells - одна продажа взамен нескольких снятых (объединение продаж). На каждую снятую
+// продажу пишется своё намерение с общим client order ID, и Done вызывается для каждого
+func (o *Outbox) ReplaceSells(ctx context.Context, oldSellOrderIDs []string, req exchange.SpotOrderRequest) ([]int64, *exchange.OrderResponse, error) {
+	intents := make([]repository.Intent, len(oldSellOrderIDs))
+	for i, orderID := range oldSellOrderIDs {
+		intents[i] = repository.Intent{Kind: repository.IntentReplace, OrderID: orderID}
+	}
+	return o.place(ctx, intents, req)
+}
+
+// PlaceOrder - ордер воркера, который хранит свои ордера сам (сетка, DCA).
+// После сохранения ордера в хранилище воркера намерение отмечается через Done
+func (o *Outbox) PlaceOrder(ctx context.Context, req exchange.SpotOrderRequest) (int64, *exchange.OrderResponse, error) {
+	return o.placeOne(ctx, repository.Intent{Kind: repository.IntentOrder}, req)
+}
+
+// PlaceBuy - покупка, которая после ответа записывается в состояния покупок и журнал лотов.
+// После записи лота намерение отмечается через Done
+func (o *Outbox) PlaceBuy(ctx context.Context, req exchange.SpotOrderRequest) (int64, *exchange.OrderResponse, error) {
+	return o.placeOne(ctx, repository.Intent{Kind: repository.IntentBuy}, req)
+}
+
+// PlaceBuys - пачка покупок (лесенка). На каждую покупку своё намерение и client order ID.
+// Ответы в порядке запросов, у не созданных ордеров пустой OrderID. Созданные до ошибки
+// посреди пачки ордера возвращаются вместе с ошибкой; Done вызывается для каждого созданного
+func (o *Outbox) PlaceBuys(ctx context.Context, reqs []exchange.SpotOrderRequest) ([]int64, []exchange.OrderResponse, error) {
+	reqs = slices.Clone(reqs)
+	ids := make([]int64, 0, len(reqs))
+	for i := range reqs {
+		id, err := o.repo.AddIntent(ctx, repository.Intent{Kind: repository.IntentBuy, Price: reqs[i].Price, Qty: reqs[i].Quantity})
+		if err != nil {
+			o.failAll(ctx, ids, err)
+			return nil, nil, fmt.Errorf("ошибка записи намерения: %w", err)
+		}
+		ids = append(ids, id)
+		reqs[i].ClientOrderID = o.clientOrderID(id)
+		if err := o.repo.SetClientOrderID(ctx, id, reqs[i].ClientOrderID); err != nil {
+			o.failAll(ctx, ids, err)
+			return nil, nil, fmt.Errorf("ошибка записи намерения: %w", err)
+		}
+	}
+
+	responses, err := o.exchange.PlaceBatchOrders(ctx, reqs)
+	result := make([]exchange.OrderResponse, len(reqs))
+	copy(result, responses)
+	for i, id := range ids {
+		switch {
+		case result[i].OrderID != "":
+		case i < len(responses):
+			// биржа отклонила ордер пачки
+			o.fail(ctx, id, errors.New("ордер пачки не создан"))
+		case err == nil:
+			// обёртка биржи отправила только часть пачки
+			o.fail(ctx, id, errors.New("ордер пачки не отправлен"))
+		case errors.Is(err, exchange.ErrBlocked):
+			o.fail(ctx, id, err)
+		default:
+			// ответ мог потеряться после создания ордера - проверяем по client order ID
+			order, lookupErr := o.exchange.GetOrder(ctx, o.cfg.Symbol, "", reqs[i].ClientOrderID)
+			switch {
+			case errors.Is(lookupErr, exchange.ErrOrderNotFound):
+				o.fail(ctx, id, err)
+			case lookupErr != nil:
+				log.Printf("Намерение %d: неизвестно, создан ли ордер (%v), разбор при запуске: %v", id, lookupErr, err)
+			default:
+				log.Printf("Ордер %s создан, несмотря на ошибку: %v", order.OrderID, err)
+				result[i] = *orderResponse(order)
+			}
+		}
+	}
+	return ids, result, err
+}
+
+func (o *Outbox) placeOne(ctx context.Context, intent repository.Intent, req exchange.SpotOrderRequest) (int64, *exchange.OrderResponse, error) {
+	ids, orderResp, err := o.place(ctx, []repository.Intent{intent}, req)
+	if err != nil {
+		return 0, nil, err
+	}
+	return ids[0], orderResp, nil
+}
+
+// place - записывает намерения и отправляет ордер. Намерения отклоняются, только если биржа
+// точно не создала ордер; иначе остаются PENDING и при запуске их разберёт Replayer
+func (o *Outbox) place(ctx context.Context, intents []repository.Intent, req exchange.SpotOrderRequest) ([]int64, *exchange.OrderResponse, error) {
+	ids := make([]int64, 0, len(intents))
+	for _, intent := range intents {
+		intent.Price = req.Price
+		intent.Qty = req.Quantity
+		id, err := o.repo.AddIntent(ctx, intent)
+		if err != nil {
+			o.failAll(ctx, ids, err)
+			return nil, nil, fmt.Errorf("ошибка записи намерения: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	// client order ID выводится из ID первого намерения, поэтому известен до отправки
+	req.ClientOrderID = o.clientOrderID(ids[0])
+	for _, id := range ids {
+		if err := o.repo.SetClientOrderID(ctx, id, req.ClientOrderID); err != nil {
+			o.failAll(ctx, ids, err)
+			return nil, nil, fmt.Errorf("ошибка записи намерения: %w", err)
+		}
+	}
+
+	orderResp, err := o.exchange.PlaceOrder(ctx, req)
+	if errors.Is(err, exchange.ErrBlocked) {
+		// обёртка биржи не отправила ордер
+		o.failAll(ctx, ids, err)
+		return nil, nil, err
+	}
+	if err != nil {
+		// ответ мог потеряться после создания ордера - проверяем по client order ID
+		order, lookupErr := o.exchange.GetOrder(ctx, o.cfg.Symbol, "", req.ClientOrderID)
+		if errors.Is(lookupErr, exchange.ErrOrderNotFound) {
+			o.failAll(ctx, ids, err)
+			return nil, nil, err
+		}
+		if lookupErr != nil {
+			log.Printf("Намерение %d: неизвестно, создан ли ордер (%v), разбор при запуске: %v", ids[0], lookupErr, err)
+			return nil, nil, err
+		}
+		log.Printf("Ордер %s создан, несмотря на ошибку: %v", order.OrderID, err)
+		orderResp = orderResponse(order)
+	}
+	return ids, orderResp, nil
+}
+
+// Done - намерение выполнено и записано в журнал лотов
+func (o *Outbox) Done(ctx context.Context, id int64, orderID string) {
+	if err := o.repo.MarkIntentDone(ctx, id, orderID); err != nil {
+		tools.LogErrorf("Ошибка отметки намерения %d: %v", id, err)
+	}
+}
+
+// CancelOrder - отмена ордера через журнал намерений. Если отмена не дошла до биржи
+// из-за падения процесса, Replayer отменит ордер при запуске
+func (o *Outbox) CancelOrder(ctx context.Context, symbol, orderID string) error {
+	id, err := o.repo.AddIntent(ctx, repository.Intent{Kind: repository.IntentCancel, OrderID: orderID})
+	if err != nil {
+		return fmt.Errorf("ошибка записи намерения отмены: %w", err)
+	}
+	if err := o.exchange.CancelOrder(ctx, symbol, orderID); err != nil {
+		o.fail(ctx, id, err)
+		return err
+	}
+	o.Done(ctx, id, orderID)
+	return nil
+}
+
+// clientOrderID - client order ID намерения: <prefix>-<ID экземпляра>-o<ID намерения>
+func (o *Outbox) clientOrderID(id int64) string {
+	return fmt.Sprintf("%s-%s-o%s", o.cfg.Instance.ClientIDPrefix, o.instanceID, strconv.FormatInt(id, 36))
+}
+
+func (o *Outbox) fail(ctx context.Context, id int64, reason error) {
+	if err := o.repo.MarkIntentFailed(ctx, id, reason.Error()); err != nil {
+		tools.LogErrorf("Ошибка отметки намерения %d: %v", id, err)
+	}
+}
+
+func (o *Outbox) failAll(ctx context.Context, ids []int64, reason error) {
+	for _, id := range ids {
+		o.fail(ctx, id, reason)
+	}
+}
+
+// orderResponse - ответ на создание ордера по найденному ордеру
+func orderResponse(order *exchange.OrderInfo) *exchange.OrderResponse {
+	return &exchange.OrderResponse{
+		Symbol:       order.Symbol,
+		OrderID:      order.OrderID,
+		Price:        order.Price,
+		OrigQty:      order.OrigQty,
+		Type:         order.Type,
+		Side:         order.Side,
+		TransactTime: order.Time,
+	}
+}
+
+// Seller - повторное размещение продажи (takeprofit.Placer)
+type Seller interface {
+	PlaceSell(ctx context.Context, buyOrderID string, buyPrice, qty float64) (*exchange.OrderResponse, error)
+}
+
+// Replayer - разбор неподтверждённых намерений прошлого запуска.
+// Запускается один раз до сверки, чтобы сверка видела продажи, созданные перед падением
+type Replayer struct {
+	config   config.Config
+	exchange exchange.Exchange
+	repo     repository.OutboxRepository
+	lots     repository.LotRepository
+	seller   Seller
+	logger   logger.Logger
+}
+
+// NewReplayer - конструктор
+func NewReplayer(cfg config.Config, ex exchange.Exchange, repo repository.OutboxRepository, lots repository.LotRepository,
+	seller Seller, logLogger logger.Logger) *Replayer {
+	return &Replayer{
+		config:   cfg,
+		exchange: ex,
+		repo:     repo,
+		lots:     lots,
+		seller:   seller,
+		logger:   logLogger,
+	}
+}
+
+// Run - доводит неподтверждённые намерения до конца. Повторный запуск безопасен:
+// ордер по намерению создаётся, только если биржа не знает его client order ID
+func (r *Replayer) Run(ctx context.Context) error {
+	intents, err := r.repo.PendingIntents(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения журнала намерений: %w", err)
+	}
+	for _, intent := range intents {
+		switch intent.Kind {
+		case repository.IntentSell:
+			err = r.replaySell(ctx, intent)
+		case repository.IntentReplace:
+			err = r.replayReplace(ctx, intent)
+		case repository.IntentOrder:
+			err = r.replayOrder(ctx, intent)
+		case repository.IntentBuy:
+			err = r.replayBuy(ctx, intent)
+		case repository.IntentCancel:
+			err = r.replayCancel(ctx, intent)
+		default:
+			err = r.repo.MarkIntentFailed(ctx, intent.ID, "неизвестный вид намерения")
+		}
+		if err != nil {
+			return fmt.Errorf("намерение %d (%s): %w", intent.ID, intent.Kind, err)
+		}
+	}
+	if len(intents) > 0 {
+		r.logger.Notify(fmt.Sprintf("Разобрано неподтверждённых намерений прошлого запуска: %d", len(intents)))
+	}
+
+	if err := r.repo.PruneIntents(ctx, time.Now().Add(-retention)); err != nil {
+		tools.LogErrorf("Ошибка очистки журнала намерений: %v", err)
+	}
+	return nil
+}
+
+// replaySell - продажа создана на бирже: записывается в журнал лотов. Не создана: размещается заново
+func (r *Replayer) replaySell(ctx context.Context, intent repository.Intent) error {
+	if intent.ClientOrderID != "" {
+		order, err := r.exchange.GetOrder(ctx, r.config.Symbol, "", intent.ClientOrderID)
+		switch {
+		case err == nil:
+			// ErrLotNotFound - продажа уже в журнале, не отмечено только намерение
+			err := r.lots.SetSellOrder(ctx, intent.BuyOrderID, order.OrderID, intent.Price)
+			if err != nil && !errors.Is(err, repository.ErrLotNotFound) {
+				return err
+			}
+			log.Printf("Намерение %d: продажа %s для %s найдена на бирже", intent.ID, order.OrderID, intent.BuyOrderID)
+			return r.repo.MarkIntentDone(ctx, intent.ID, order.OrderID)
+		case !errors.Is(err, exchange.ErrOrderNotFound):
+			return err
+		}
+	}
+
+	// до биржи не дошло: новое намерение создаст Seller
+	if err := r.repo.MarkIntentFailed(ctx, intent.ID, "ордер не дошёл до биржи"); err != nil {
+		return err
+	}
+	orderResp, err := r.seller.PlaceSell(ctx, intent.BuyOrderID, intent.BuyPrice, intent.Qty)
+	if err != nil {
+		// лот остаётся FILLED, его покажет сверка
+		log.Printf("Намерение %d: ошибка повторной продажи для %s: %v", intent.ID, intent.BuyOrderID, err)
+		return nil
+	}
+	log.Printf("Намерение %d: продажа для %s размещена заново: %s", intent.ID, intent.BuyOrderID, orderResp.OrderID)
+	return nil
+}
+
+// replayReplace - продажа взамен снятой создана: лоты переносятся на неё. Не создана: лоты
+// снятой продажи возвращаются в FILLED, и сверка выставит для них продажу или покажет в отчёте
+func (r *Replayer) replayReplace(ctx context.Context, intent repository.Intent) error {
+	if intent.ClientOrderID != "" {
+		order, err := r.exchange.GetOrder(ctx, r.config.Symbol, "", intent.ClientOrderID)
+		switch {
+		case err == nil:
+			err := r.lots.ReplaceSellOrder(ctx, intent.OrderID, order.OrderID, intent.Price)
+			if err != nil && !errors.Is(err, repository.ErrLotNotFound) {
+				return err
+			}
+			log.Printf("Намерение %d: продажа %s взамен %s найдена на бирже", intent.ID, order.OrderID, intent.OrderID)
+			return r.repo.MarkIntentDone(ctx, intent.ID, order.OrderID)
+		case !errors.Is(err, exchange.ErrOrderNotFound):
+			return err
+		}
+	}
+
+	if err := r.lots.ReopenLot(ctx, intent.OrderID); err != nil && !errors.Is(err, repository.ErrLotNotFound) {
+		return err
+	}
+	log.Printf("Намерение %d: продажа взамен %s не дошла до биржи, лоты возвращены без продажи", intent.ID, intent.OrderID)
+	return r.repo.MarkIntentFailed(ctx, intent.ID, "ордер не дошёл до биржи")
+}
+
+// replayOrder - ордер сетки или DCA, который воркер не успел сохранить. Воркер о нём
+// не знает и выставит свой, поэтому открытый ордер отменяется
+func (r *Replayer) replayOrder(ctx context.Context, intent repository.Intent) error {
+	if intent.ClientOrderID == "" {
+		return r.repo.MarkIntentFailed(ctx, intent.ID, "ордер не дошёл до биржи")
+	}
+	order, err := r.exchange.GetOrder(ctx, r.config.Symbol, "", intent.ClientOrderID)
+	if errors.Is(err, exchange.ErrOrderNotFound) {
+		return r.repo.MarkIntentFailed(ctx, intent.ID, "ордер не дошёл до биржи")
+	}
+	if err != nil {
+		return err
+	}
+	if order.Status == exchange.New || order.Status == exchange.PartiallyFilled {
+		if err := r.exchange.CancelOrder(ctx, r.config.Symbol, order.OrderID); err != nil {
+			return err
+		}
+		log.Printf("Намерение %d: несохранённый ордер %s отменён", intent.ID, order.OrderID)
+	}
+	if executed, _ := strconv.ParseFloat(order.ExecutedQty, 64); executed > 0 {
+		r.logger.Warn(fmt.Sprintf("Несохранённый ордер %s (%s) исполнен на %s, проверьте баланс", order.OrderID, order.Side, order.ExecutedQty))
+	}
+	return r.repo.MarkIntentDone(ctx, intent.ID, order.OrderID)
+}
+
+// replayBuy - покупка создана на бирже: записывается в журнал лотов, и её подхватит сверка
+// (отслеживание открытой или продажа исполненной). Не создана: покупку выставит воркер
+func (r *Replayer) replayBuy(ctx context.Context, intent repository.Intent) error {
+	if intent.ClientOrderID == "" {
+		return r.repo.MarkIntentFailed(ctx, intent.ID, "ордер не дошёл до биржи")
+	}
+	order, err := r.exchange.GetOrder(ctx, r.config.Symbol, "", intent.ClientOrderID)
+	if errors.Is(err, exchange.ErrOrderNotFound) {
+		return r.repo.MarkIntentFailed(ctx, intent.ID, "ордер не дошёл до биржи")
+	}
+	if err != nil {
+		return err
+	}
+	lots, err := r.lots.GetLotsByOrderID(ctx, order.OrderID)
+	if err != nil {
+		return err
+	}
+	if len(lots) == 0 {
+		_, err := r.lots.CreateLot(ctx, repository.Lot{
+			Symbol:     r.config.Symbol,
+			BuyOrderID: order.OrderID,
+			BuyPrice:   intent.Price,
+			BuyQty:     intent.Qty,
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("Намерение %d: покупка %s найдена на бирже и записана в журнал", intent.ID, order.OrderID)
+	}
+	return r.repo.MarkIntentDone(ctx, intent.ID, order.OrderID)
+}
+
+// replayCancel - ордер ещё открыт: отменяется. Журнал лотов по отмене обновит сверка
+func (r *Replayer) replayCancel(ctx context.Context, intent repository.Intent) error {
+	order, err := r.exchange.GetOrder(ctx, r.config.Symbol, intent.OrderID, "")
+	if errors.Is(err, exchange.ErrOrderNotFound) {
+		return r.repo.MarkIntentFailed(ctx, intent.ID, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	if order.Status == exchange.New || order.Status == exchange.PartiallyFilled {
+		if err := r.exchange.CancelOrder(ctx, r.config.Symbol, intent.OrderID); err != nil {
+			return err
+		}
+		log.Printf("Намерение %d: ордер %s отменён", intent.ID, intent.OrderID)
+	}
+	return r.repo.MarkIntentDone(ctx, intent.ID, intent.OrderID)
+}
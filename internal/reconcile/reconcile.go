@@ -0,0 +1,448 @@
+// Package reconcile - сверка журнала позиций с биржей при старте бота.
+// После перезапуска состояния покупок и позиции пустые, поэтому исполнения
+// покупок игнорируются лиснером и sell_v1, а монеты остаются непроданными
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/logger"
+	"scalpingbot/internal/repo"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/takeprofit"
+	"scalpingbot/internal/tools"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// missingSell - исполненная покупка без ордера на продажу
+type missingSell struct {
+	buyOrderID string
+	price      float64
+	qty        float64
+}
+
+// Report - итог сверки
+type Report struct {
+	RestoredBuys      int      // открытые покупки снова отслеживаются
+	RestoredPositions int      // позиции с открытой продажей восстановлены
+	ClosedLots        int      // продажи исполнились, пока бот был выключен
+	CanceledBuys      int      // покупки отменены без исполнения
+	PlacedSells       int      // недостающие продажи выставлены
+	MissingSells      []string // исполненные покупки без продажи, оставленные на ручное решение
+	Unknown           []string // ордера журнала, которых нет ни в открытых, ни в истории
+	Untracked         []string // открытые покупки на бирже, которых нет в журнале
+}
+
+// String - текст отчёта для Telegram
+func (r Report) String() string {
+	var sb strings.Builder
+	sb.WriteString("Сверка при старте:\n")
+	sb.WriteString(fmt.Sprintf("Покупок в работе: %d\n", r.RestoredBuys))
+	sb.WriteString(fmt.Sprintf("Позиций восстановлено: %d\n", r.RestoredPositions))
+	sb.WriteString(fmt.Sprintf("Закрыто продаж: %d\n", r.ClosedLots))
+	sb.WriteString(fmt.Sprintf("Отменено покупок: %d\n", r.CanceledBuys))
+	sb.WriteString(fmt.Sprintf("Выставлено продаж: %d\n", r.PlacedSells))
+	if len(r.MissingSells) > 0 {
+		sb.WriteString(fmt.Sprintf("Покупки без продажи (%d): %s\n", len(r.MissingSells), strings.Join(r.MissingSells, "; ")))
+	}
+	if len(r.Unknown) > 0 {
+		sb.WriteString(fmt.Sprintf("Не найдены на бирже (%d): %s\n", len(r.Unknown), strings.Join(r.Unknown, ", ")))
+	}
+	if len(r.Untracked) > 0 {
+		sb.WriteString(fmt.Sprintf("Покупки вне журнала (%d): %s\n", len(r.Untracked), strings.Join(r.Untracked, ", ")))
+	}
+	return sb.String()
+}
+
+// needsAttention - есть ли в отчёте что-то, что требует решения
+func (r Report) needsAttention() bool {
+	return r.PlacedSells > 0 || len(r.MissingSells) > 0 || len(r.Unknown) > 0 || len(r.Untracked) > 0
+}
+
+// Reconciler - восстанавливает состояния покупок и позиции по журналу и ордерам биржи
+type Reconciler struct {
+	config    config.Config
+	exchange  exchange.Exchange
+	orders    repo.OrderStateRepo
+	positions repo.PositionRepo
+	lots      repository.LotRepository
+	placer    *takeprofit.Placer
+	logger    logger.Logger
+}
+
+// NewReconciler - конструктор
+func NewReconciler(cfg config.Config, ex exchange.Exchange, orders repo.OrderStateRepo, positions repo.PositionRepo,
+	lots repository.LotRepository, placer *takeprofit.Placer, logLogger logger.Logger) *Reconciler {
+	return &Reconciler{
+		config:    cfg,
+		exchange:  ex,
+		orders:    orders,
+		positions: positions,
+		lots:      lots,
+		placer:    placer,
+		logger:    logLogger,
+	}
+}
+
+// Run - сверка. Вызывается один раз до запуска воркеров и лиснера.
+// Сверяются лоты, изменённые за lookback_hours, и лоты с открытыми на бирже ордерами:
+// по более старым история ордеров всё равно не загружается
+func (r *Reconciler) Run(ctx context.Context) (Report, error) {
+	var report Report
+
+	openOrders, err := r.exchange.GetOpenOrders(ctx, r.config.Symbol)
+	if err != nil {
+		return report, fmt.Errorf("ошибка получения открытых ордеров: %w", err)
+	}
+	lots, err := r.fetchLots(ctx, openOrders)
+	if err != nil {
+		return report, fmt.Errorf("ошибка чтения журнала: %w", err)
+	}
+	history, err := r.fetchHistory(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	// Открытые ордера свежее истории, поэтому перекрывают её
+	orders := make(map[string]exchange.OrderInfo, len(history)+len(openOrders))
+	for _, order := range history {
+		orders[order.OrderID] = order
+	}
+	for _, order := range openOrders {
+		orders[order.OrderID] = order
+	}
+
+	var missing []missingSell
+	known := make(map[string]struct{}, len(lots))
+	for _, lot := range lots {
+		known[lot.BuyOrderID] = struct{}{}
+
+		switch lot.State {
+		case repository.LotNew:
+			order, ok := orders[lot.BuyOrderID]
+			if !ok {
+				report.Unknown = append(report.Unknown, lot.BuyOrderID)
+				continue
+			}
+			executed, _ := strconv.ParseFloat(order.ExecutedQty, 64)
+			switch order.Status {
+			case exchange.New, exchange.PartiallyFilled:
+				r.orders.Track(lot.BuyOrderID)
+				if order.Status == exchange.PartiallyFilled {
+					r.orders.Transition(lot.BuyOrderID, repo.OrderPartial, repo.OrderNew)
+				}
+				report.RestoredBuys++
+			case exchange.Filled:
+				missing = append(missing, missingSell{buyOrderID: lot.BuyOrderID, price: lot.BuyPrice, qty: executed})
+			default:
+				if executed > 0 {
+					missing = append(missing, missingSell{buyOrderID: lot.BuyOrderID, price: lot.BuyPrice, qty: executed})
+					continue
+				}
+				if err := r.lots.MarkBuyCanceled(ctx, lot.BuyOrderID); err != nil {
+					log.Printf("Сверка: ошибка записи отмены покупки %s: %v", lot.BuyOrderID, err)
+					continue
+				}
+				report.CanceledBuys++
+			}
+
+		case repository.LotFilled:
+			missing = append(missing, missingSell{buyOrderID: lot.BuyOrderID, price: lot.BuyPrice, qty: lot.BuyQty})
+
+		case repository.LotSellPlaced:
+			order, ok := orders[lot.SellOrderID]
+			if !ok {
+				report.Unknown = append(report.Unknown, lot.SellOrderID)
+				continue
+			}
+			executed, _ := strconv.ParseFloat(order.ExecutedQty, 64)
+			switch order.Status {
+			case exchange.New, exchange.PartiallyFilled:
+				r.restorePosition(lot)
+				report.RestoredPositions++
+			case exchange.Filled:
+				price := exchange.FillPrice(order.Price, order.ExecutedQty, order.QuoteQty)
+				// Несколько лотов одной продажи закрываются первым вызовом
+				err := r.placer.CloseSell(ctx, lot.SellOrderID, price, executed)
+				if err != nil && !errors.Is(err, repository.ErrLotNotFound) {
+					log.Printf("Сверка: ошибка закрытия лотов продажи %s: %v", lot.SellOrderID, err)
+					continue
+				}
+				if err == nil {
+					report.ClosedLots++
+				}
+			default:
+				// Продажа отменена вручную: если она ничего не продала, монеты снова без продажи
+				if executed > 0 {
+					report.Unknown = append(report.Unknown, lot.SellOrderID)
+					continue
+				}
+				if err := r.lots.ReopenLot(ctx, lot.SellOrderID); err != nil && !errors.Is(err, repository.ErrLotNotFound) {
+					log.Printf("Сверка: ошибка возврата лота продажи %s: %v", lot.SellOrderID, err)
+					continue
+				}
+				missing = append(missing, missingSell{buyOrderID: lot.BuyOrderID, price: lot.BuyPrice, qty: lot.BuyQty})
+			}
+		}
+	}
+
+	missing = r.addUncovered(ctx, lots, orders, missing)
+	if err := r.handleMissing(ctx, missing, &report); err != nil {
+		return report, err
+	}
+	r.handleOpenBuys(openOrders, known, &report)
+	r.handleUntracked(openOrders, known, &report)
+
+	if report.needsAttention() {
+		r.logger.Notify(report.String())
+	} else {
+		log.Print(report.String())
+	}
+	return report, nil
+}
+
+// addUncovered - исполнение закрытых на бирже покупок, которое не покрыто журналом. У покупки,
+// частично исполненной до остановки, NEW лота уже нет, и исполнение, пока бот был выключен, видно
+// только по ExecutedQty ордера. Недостача сверх продаж (CoveredQty) и FILLED лотов из missing
+// добавляется к продаже этой покупки. Открытые покупки продаст sell_v1 по мере исполнения
+func (r *Reconciler) addUncovered(ctx context.Context, lots []repository.Lot, orders map[string]exchange.OrderInfo, missing []missingSell) []missingSell {
+	skip := make(map[string]struct{})
+	for _, lot := range lots {
+		if lot.State == repository.LotNew {
+			// исполнение покупки с NEW лотом уже учтено целиком
+			skip[lot.BuyOrderID] = struct{}{}
+		}
+	}
+	for _, lot := range lots {
+		if _, ok := skip[lot.BuyOrderID]; ok {
+			continue
+		}
+		skip[lot.BuyOrderID] = struct{}{}
+
+		order, ok := orders[lot.BuyOrderID]
+		if !ok || order.Side != exchange.Buy || order.Status == exchange.New || order.Status == exchange.PartiallyFilled {
+			continue
+		}
+		executed, err := strconv.ParseFloat(order.ExecutedQty, 64)
+		if err != nil {
+			continue
+		}
+		covered, err := r.lots.CoveredQty(ctx, lot.BuyOrderID)
+		if err != nil {
+			log.Printf("Сверка: ошибка расчёта проданного по покупке %s: %v", lot.BuyOrderID, err)
+			continue
+		}
+		pending := -1
+		for i, m := range missing {
+			if m.buyOrderID == lot.BuyOrderID {
+				covered += m.qty
+				if pending < 0 {
+					pending = i
+				}
+			}
+		}
+		short := executed - covered
+		if short*lot.BuyPrice < exchange.MinNotional {
+			continue
+		}
+		log.Printf("Сверка: исполнение покупки %s не покрыто журналом на %.8f", lot.BuyOrderID, short)
+		// FILLED лот покупки продаётся вместе с недостачей одной продажей
+		if pending >= 0 {
+			missing[pending].qty += short
+			continue
+		}
+		missing = append(missing, missingSell{buyOrderID: lot.BuyOrderID, price: lot.BuyPrice, qty: short})
+	}
+	return missing
+}
+
+// handleMissing - выставляет недостающие продажи (auto_sell) или оставляет их на ручное решение
+func (r *Reconciler) handleMissing(ctx context.Context, missing []missingSell, report *Report) error {
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var kasFreeBalance float64
+	if r.config.Reconcile.AutoSell {
+		accountInfo, err := r.exchange.GetAccountInfo(ctx)
+		if err != nil {
+			return err
+		}
+		kasFreeBalance, err = accountInfo.GetKasBalance()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, m := range missing {
+		if m.qty <= 0 {
+			continue
+		}
+		if !r.config.Reconcile.AutoSell || kasFreeBalance < m.qty {
+			// Фиксируем исполнение в журнале, чтобы покупка была видна как FILLED
+			if err := r.lots.MarkBuyFilled(ctx, m.buyOrderID, m.price, m.qty); err != nil {
+				log.Printf("Сверка: ошибка записи покупки %s: %v", m.buyOrderID, err)
+			}
+			report.MissingSells = append(report.MissingSells, fmt.Sprintf("%s %.8f@%.8f", m.buyOrderID, m.qty, m.price))
+			continue
+		}
+
+		orderResp, err := r.placer.PlaceSell(ctx, m.buyOrderID, m.price, m.qty)
+		if err != nil {
+			log.Printf("Сверка: ошибка размещения продажи для %s: %v", m.buyOrderID, err)
+			report.MissingSells = append(report.MissingSells, fmt.Sprintf("%s %.8f@%.8f", m.buyOrderID, m.qty, m.price))
+			continue
+		}
+		kasFreeBalance -= m.qty
+		report.PlacedSells++
+		log.Printf("Сверка: продажа для %s размещена: %s цена=%s", m.buyOrderID, orderResp.OrderID, orderResp.Price)
+	}
+	return nil
+}
+
+// handleOpenBuys - покупки журнала, которые ещё открыты на бирже, но чьи лоты уже исполнены
+// частично (FILLED или SELL_PLACED). Без отслеживания лиснер и sell_v1 не обработают
+// остаток покупки, а handleUntracked их пропускает, потому что они есть в журнале
+func (r *Reconciler) handleOpenBuys(openOrders []exchange.OrderInfo, known map[string]struct{}, report *Report) {
+	for _, order := range openOrders {
+		if order.Side != exchange.Buy {
+			continue
+		}
+		if _, ok := known[order.OrderID]; !ok {
+			continue
+		}
+		if _, ok := r.orders.Get(order.OrderID); ok {
+			continue
+		}
+		r.orders.Track(order.OrderID)
+		r.orders.Transition(order.OrderID, repo.OrderPartial, repo.OrderNew)
+		report.RestoredBuys++
+	}
+}
+
+// handleUntracked - открытые покупки, которых нет в журнале (выставлены до появления журнала или вручную).
+// Сетка и DCA ведут свои ордера сами, поэтому при них покупки вне журнала в работу не берутся
+func (r *Reconciler) handleUntracked(openOrders []exchange.OrderInfo, known map[string]struct{}, report *Report) {
+	adopt := r.config.Reconcile.TrackUntracked && !r.config.Grid.Enabled && !r.config.DCA.Enabled
+	for _, order := range openOrders {
+		if order.Side != exchange.Buy {
+			continue
+		}
+		if _, ok := known[order.OrderID]; ok {
+			continue
+		}
+		if adopt {
+			r.orders.Track(order.OrderID)
+			if order.Status == exchange.PartiallyFilled {
+				r.orders.Transition(order.OrderID, repo.OrderPartial, repo.OrderNew)
+			}
+			report.RestoredBuys++
+			continue
+		}
+		report.Untracked = append(report.Untracked, order.OrderID)
+	}
+}
+
+// restorePosition - возвращает позицию с открытой продажей под контроль трейлинга и стопа
+func (r *Reconciler) restorePosition(lot repository.Lot) {
+	if _, ok := r.positions.Get(lot.SellOrderID); ok {
+		return
+	}
+	target := lot.SellPrice
+	if r.config.Trailing.Enabled {
+		target = lot.SellPrice / (1 + r.config.Trailing.ProtectivePercent/100)
+	}
+	var targetPct float64
+	if lot.BuyPrice > 0 {
+		targetPct = (target/lot.BuyPrice - 1) * 100
+	}
+	r.positions.Add(repo.Position{
+		BuyOrderID:    lot.BuyOrderID,
+		SellOrderID:   lot.SellOrderID,
+		EntryPrice:    lot.BuyPrice,
+		Qty:           lot.BuyQty,
+		TargetPrice:   target,
+		TargetPercent: targetPct,
+		SellPrice:     lot.SellPrice,
+		OpenedAt:      lot.CreatedTime(),
+		Trailing:      r.config.Trailing.Enabled,
+	})
+}
+
+// fetchLots - незакрытые лоты за lookback_hours и лоты старше окна, ордера которых ещё открыты
+func (r *Reconciler) fetchLots(ctx context.Context, openOrders []exchange.OrderInfo) ([]repository.Lot, error) {
+	since := time.Now().Add(-time.Duration(r.config.Reconcile.LookbackHours) * time.Hour)
+	lots, err := r.lots.GetLotsUpdatedSince(ctx, since, repository.LotNew, repository.LotFilled, repository.LotSellPlaced)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, 2*len(lots))
+	ids := make(map[int64]struct{}, len(lots))
+	for _, lot := range lots {
+		seen[lot.BuyOrderID] = struct{}{}
+		seen[lot.SellOrderID] = struct{}{}
+		ids[lot.ID] = struct{}{}
+	}
+	for _, order := range openOrders {
+		if _, ok := seen[order.OrderID]; ok {
+			continue
+		}
+		orderLots, err := r.lots.GetLotsByOrderID(ctx, order.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		for _, lot := range orderLots {
+			if _, ok := ids[lot.ID]; ok {
+				continue
+			}
+			switch lot.State {
+			case repository.LotNew, repository.LotFilled, repository.LotSellPlaced:
+				ids[lot.ID] = struct{}{}
+				lots = append(lots, lot)
+			}
+		}
+	}
+	return lots, nil
+}
+
+// fetchHistory - история ордеров за lookback_hours, постранично от конца интервала
+func (r *Reconciler) fetchHistory(ctx context.Context) ([]exchange.OrderInfo, error) {
+	var allOrders []exchange.OrderInfo
+	now := time.Now()
+	endTime := now.UnixMilli()
+	startTime := now.Add(-time.Duration(r.config.Reconcile.LookbackHours) * time.Hour).UnixMilli()
+
+	for {
+		orders, err := r.exchange.GetAllOrders(ctx, r.config.Symbol, startTime, endTime)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения истории ордеров: %w", err)
+		}
+		if len(orders) == 0 {
+			break
+		}
+		allOrders = append(allOrders, orders...)
+
+		minTime := orders[0].Time
+		for _, o := range orders {
+			if o.Time < minTime {
+				minTime = o.Time
+			}
+		}
+		endTime = minTime - 1
+		if endTime < startTime {
+			break
+		}
+		// для обхода rate-limit
+		if err := tools.Sleep(ctx, 500*time.Millisecond); err != nil {
+			return nil, err
+		}
+	}
+	return allOrders, nil
+}
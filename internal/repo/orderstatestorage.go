@@ -0,0 +1,110 @@
+package repo
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// OrderState - состояние покупки бота от размещения до закрытия тейк-профитом
+type OrderState string
+
+const (
+	OrderNew        OrderState = "NEW"         // стоит на бирже
+	OrderPartial    OrderState = "PARTIAL"     // частично исполнена, исполненная часть продаётся по мере исполнения
+	OrderFilled     OrderState = "FILLED"      // исполнена, тейк-профит ещё не размещён
+	OrderSellPlaced OrderState = "SELL_PLACED" // тейк-профит размещается или размещён
+	OrderClosed     OrderState = "CLOSED"      // тейк-профит исполнен
+	OrderCanceled   OrderState = "CANCELED"    // отменена без исполнения
+)
+
+// orderTransitions - разрешённые переходы. SELL_PLACED -> FILLED и CANCELED -> NEW -
+// откат, если продажу разместить или покупку отменить не удалось
+var orderTransitions = map[OrderState][]OrderState{
+	OrderNew:        {OrderPartial, OrderFilled, OrderCanceled},
+	OrderPartial:    {OrderPartial, OrderFilled, OrderCanceled},
+	OrderFilled:     {OrderSellPlaced},
+	OrderSellPlaced: {OrderFilled, OrderClosed},
+	OrderCanceled:   {OrderNew},
+}
+
+// orderStateTTL - сколько хранить покупки в конечном состоянии, чтобы поздние
+// обновления по ним не принимались за обновления продаж
+const orderStateTTL = 24 * time.Hour
+
+// OrderStateRepo - состояния покупок бота. Transition - атомарный переход: из всех
+// компонентов, которые одновременно обрабатывают одно исполнение, действует только тот,
+// чей переход прошёл
+type OrderStateRepo interface {
+	Track(orderID string)
+	Get(orderID string) (OrderState, bool)
+	Tracked(orderID string) bool
+	Transition(orderID string, to OrderState, from ...OrderState) bool
+}
+
+type orderStateEntry struct {
+	state     OrderState
+	updatedAt time.Time
+}
+
+// OrderStateStorage — потокобезопасное хранилище состояний покупок
+type OrderStateStorage struct {
+	mu    sync.Mutex
+	items map[string]orderStateEntry
+}
+
+func NewOrderStateStorage() *OrderStateStorage {
+	return &OrderStateStorage{
+		items: make(map[string]orderStateEntry),
+	}
+}
+
+// Track — новая покупка в состоянии NEW
+func (s *OrderStateStorage) Track(orderID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	s.items[orderID] = orderStateEntry{state: OrderNew, updatedAt: time.Now()}
+}
+
+// Get — состояние покупки, false - ордер не покупка бота
+func (s *OrderStateStorage) Get(orderID string) (OrderState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[orderID]
+	return e.state, ok
+}
+
+// Tracked — покупка бота, которая ещё не закрыта и не отменена
+func (s *OrderStateStorage) Tracked(orderID string) bool {
+	state, ok := s.Get(orderID)
+	return ok && state != OrderClosed && state != OrderCanceled
+}
+
+// Transition — переводит покупку в состояние to, если она сейчас в одном из from.
+// Возвращает false, если состояние другое (ордер уже обработан другим компонентом)
+func (s *OrderStateStorage) Transition(orderID string, to OrderState, from ...OrderState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[orderID]
+	if !ok || !slices.Contains(from, e.state) {
+		return false
+	}
+	if !slices.Contains(orderTransitions[e.state], to) {
+		log.Printf("Недопустимый переход покупки %s: %s -> %s", orderID, e.state, to)
+		return false
+	}
+	s.items[orderID] = orderStateEntry{state: to, updatedAt: time.Now()}
+	return true
+}
+
+// prune — удаляет давно закрытые и отменённые покупки
+func (s *OrderStateStorage) prune() {
+	cutoff := time.Now().Add(-orderStateTTL)
+	for id, e := range s.items {
+		if (e.state == OrderClosed || e.state == OrderCanceled) && e.updatedAt.Before(cutoff) {
+			delete(s.items, id)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"sync"
+	"time"
+)
+
+// Position - купленный объём и тейк-профит, который его закрывает
+type Position struct {
+	BuyOrderID    string
+	SellOrderID   string
+	EntryPrice    float64
+	Qty           float64
+	TargetPrice   float64 // цена тейк-профита
+	TargetPercent float64 // процент тейк-профита, выбранный для сделки
+	SellPrice     float64 // цена стоящего ордера на продажу
+	OpenedAt      time.Time
+
+	// Трейлинг тейк-профита
+	Trailing  bool    // позиция ведётся трейлингом
+	Activated bool    // цена дошла до тейк-профита, отслеживаем максимум
+	High      float64 // максимум цены после активации
+}
+
+type PositionRepo interface {
+	Add(p Position)
+	Update(p Position)
+	Remove(sellOrderID string)
+	Get(sellOrderID string) (Position, bool)
+	List() []Position
+}
+
+// PositionStorage — потокобезопасное хранилище открытых позиций.
+// Ключ - ордер на продажу: частично исполненная покупка закрывается несколькими продажами
+type PositionStorage struct {
+	mu    sync.RWMutex
+	items map[string]Position
+}
+
+func NewPositionStorage() *PositionStorage {
+	return &PositionStorage{
+		items: make(map[string]Position),
+	}
+}
+
+// Add — добавить позицию
+func (s *PositionStorage) Add(p Position) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[p.SellOrderID] = p
+}
+
+// Update — обновить позицию, если она ещё есть
+func (s *PositionStorage) Update(p Position) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[p.SellOrderID]; ok {
+		s.items[p.SellOrderID] = p
+	}
+}
+
+// Remove — удалить позицию
+func (s *PositionStorage) Remove(sellOrderID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, sellOrderID)
+}
+
+// Get — найти позицию по ордеру на продажу
+func (s *PositionStorage) Get(sellOrderID string) (Position, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.items[sellOrderID]
+	return p, ok
+}
+
+// List — снимок всех позиций
+func (s *PositionStorage) List() []Position {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Position, 0, len(s.items))
+	for _, p := range s.items {
+		result = append(result, p)
+	}
+	return result
+}
@@ -44,6 +44,11 @@ func NewSQLiteUserRepository(dbPath string) (*SQLiteUserRepository, error) {
 	return &SQLiteUserRepository{db: db}, nil
 }
 
+// DB возвращает соединение с базой для других репозиториев
+func (r *SQLiteUserRepository) DB() *sql.DB {
+	return r.db
+}
+
 // Close закрывает соединение с базой
 func (r *SQLiteUserRepository) Close() error {
 	return r.db.Close()
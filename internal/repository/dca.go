@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrDealNotFound = errors.New("dca deal not found")
+
+const dcaSchema = `
+CREATE TABLE IF NOT EXISTS dca_deal
+(
+    id            INTEGER PRIMARY KEY CHECK (id = 1),
+    base_order_id TEXT,
+    base_price    REAL,
+    base_executed REAL,
+    base_filled   INTEGER,
+    created_at    INTEGER,
+    filled_qty    REAL,
+    filled_cost   REAL,
+    tp_order_id   TEXT,
+    tp_price      REAL,
+    sold_qty      REAL,
+    sold_amount   REAL,
+    updated_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS dca_safety
+(
+    idx      INTEGER PRIMARY KEY,
+    order_id TEXT,
+    price    REAL,
+    qty      REAL,
+    executed REAL,
+    filled   INTEGER
+);
+`
+
+// DCADeal - текущая сделка усреднения
+type DCADeal struct {
+	BaseOrderID  string
+	BasePrice    float64
+	BaseExecuted float64 // исполнено по первой покупке (накопительно)
+	BaseFilled   bool
+	CreatedAt    time.Time
+	Safety       []DCASafetyOrder
+	FilledQty    float64 // куплено по всем ордерам сделки
+	FilledCost   float64
+	TPOrderID    string
+	TPPrice      float64
+	SoldQty      float64 // продано прежними тейк-профитами, отменёнными при перестановке
+	SoldAmount   float64
+}
+
+// AvgPrice - средняя цена входа
+func (d *DCADeal) AvgPrice() float64 {
+	if d.FilledQty == 0 {
+		return 0
+	}
+	return d.FilledCost / d.FilledQty
+}
+
+// DCASafetyOrder - страховочный ордер сделки
+type DCASafetyOrder struct {
+	OrderID  string
+	Price    float64
+	Qty      float64
+	Executed float64 // исполнено (накопительно)
+	Filled   bool
+}
+
+// DCARepository определяет интерфейс для хранения сделки усреднения
+type DCARepository interface {
+	GetDeal(ctx context.Context) (DCADeal, error)
+	SaveDeal(ctx context.Context, deal DCADeal) error
+	DeleteDeal(ctx context.Context) error
+}
+
+// SQLiteDCARepository реализует DCARepository с использованием SQLite
+type SQLiteDCARepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteDCARepository создает репозиторий сделки и таблицы, если их нет
+func NewSQLiteDCARepository(db *sql.DB) (*SQLiteDCARepository, error) {
+	if _, err := db.Exec(dcaSchema); err != nil {
+		return nil, err
+	}
+	return &SQLiteDCARepository{db: db}, nil
+}
+
+// GetDeal возвращает сохранённую сделку
+func (r *SQLiteDCARepository) GetDeal(ctx context.Context) (DCADeal, error) {
+	var deal DCADeal
+	var createdAt int64
+	row := r.db.QueryRowContext(ctx, `
+        SELECT base_order_id, base_price, base_executed, base_filled, created_at,
+               filled_qty, filled_cost, tp_order_id, tp_price, sold_qty, sold_amount
+        FROM dca_deal WHERE id = 1
+    `)
+	err := row.Scan(&deal.BaseOrderID, &deal.BasePrice, &deal.BaseExecuted, &deal.BaseFilled, &createdAt,
+		&deal.FilledQty, &deal.FilledCost, &deal.TPOrderID, &deal.TPPrice, &deal.SoldQty, &deal.SoldAmount)
+	if err == sql.ErrNoRows {
+		return DCADeal{}, ErrDealNotFound
+	}
+	if err != nil {
+		return DCADeal{}, err
+	}
+	deal.CreatedAt = time.UnixMilli(createdAt)
+
+	rows, err := r.db.QueryContext(ctx, "SELECT order_id, price, qty, executed, filled FROM dca_safety ORDER BY idx")
+	if err != nil {
+		return DCADeal{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var so DCASafetyOrder
+		if err := rows.Scan(&so.OrderID, &so.Price, &so.Qty, &so.Executed, &so.Filled); err != nil {
+			return DCADeal{}, err
+		}
+		deal.Safety = append(deal.Safety, so)
+	}
+	return deal, rows.Err()
+}
+
+// SaveDeal полностью заменяет сохранённую сделку
+func (r *SQLiteDCARepository) SaveDeal(ctx context.Context, deal DCADeal) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT OR REPLACE INTO dca_deal (
+            id, base_order_id, base_price, base_executed, base_filled, created_at,
+            filled_qty, filled_cost, tp_order_id, tp_price, sold_qty, sold_amount, updated_at
+        ) VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+    `, deal.BaseOrderID, deal.BasePrice, deal.BaseExecuted, deal.BaseFilled, deal.CreatedAt.UnixMilli(),
+		deal.FilledQty, deal.FilledCost, deal.TPOrderID, deal.TPPrice, deal.SoldQty, deal.SoldAmount)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM dca_safety"); err != nil {
+		return err
+	}
+	for i, so := range deal.Safety {
+		_, err := tx.ExecContext(ctx, "INSERT INTO dca_safety (idx, order_id, price, qty, executed, filled) VALUES (?, ?, ?, ?, ?, ?)",
+			i, so.OrderID, so.Price, so.Qty, so.Executed, so.Filled)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteDeal удаляет закрытую сделку
+func (r *SQLiteDCARepository) DeleteDeal(ctx context.Context) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM dca_deal"); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM dca_safety"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var ErrGridNotFound = errors.New("grid not found")
+
+const gridSchema = `
+CREATE TABLE IF NOT EXISTS grid_state
+(
+    id           INTEGER PRIMARY KEY CHECK (id = 1),
+    symbol       TEXT,
+    lower_price  REAL,
+    upper_price  REAL,
+    levels       INTEGER,
+    config_lower REAL,
+    config_upper REAL,
+    updated_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS grid_levels
+(
+    level    INTEGER PRIMARY KEY,
+    price    REAL,
+    side     TEXT,
+    order_id TEXT
+);
+`
+
+// GridState - параметры текущей сетки
+type GridState struct {
+	Symbol     string
+	LowerPrice float64
+	UpperPrice float64
+	Levels     int
+	// Границы из конфига, по которым сетка строилась изначально (до перецентровки)
+	ConfigLower float64
+	ConfigUpper float64
+}
+
+// GridLevel - один уровень сетки и ордер, который на нём стоит
+type GridLevel struct {
+	Index   int
+	Price   float64
+	Side    string // BUY, SELL или пусто, если уровень свободен
+	OrderID string
+}
+
+// GridRepository определяет интерфейс для хранения состояния сетки
+type GridRepository interface {
+	GetGrid(ctx context.Context) (GridState, []GridLevel, error)
+	SaveGrid(ctx context.Context, state GridState, levels []GridLevel) error
+	UpdateLevel(ctx context.Context, level GridLevel) error
+}
+
+// SQLiteGridRepository реализует GridRepository с использованием SQLite
+type SQLiteGridRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteGridRepository создает репозиторий сетки и таблицы, если их нет
+func NewSQLiteGridRepository(db *sql.DB) (*SQLiteGridRepository, error) {
+	if _, err := db.Exec(gridSchema); err != nil {
+		return nil, err
+	}
+	return &SQLiteGridRepository{db: db}, nil
+}
+
+// GetGrid возвращает сохранённую сетку
+func (r *SQLiteGridRepository) GetGrid(ctx context.Context) (GridState, []GridLevel, error) {
+	var state GridState
+	row := r.db.QueryRowContext(ctx, `
+        SELECT symbol, lower_price, upper_price, levels, config_lower, config_upper
+        FROM grid_state WHERE id = 1
+    `)
+	err := row.Scan(&state.Symbol, &state.LowerPrice, &state.UpperPrice, &state.Levels, &state.ConfigLower, &state.ConfigUpper)
+	if err == sql.ErrNoRows {
+		return GridState{}, nil, ErrGridNotFound
+	}
+	if err != nil {
+		return GridState{}, nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT level, price, side, order_id FROM grid_levels ORDER BY level")
+	if err != nil {
+		return GridState{}, nil, err
+	}
+	defer rows.Close()
+
+	var levels []GridLevel
+	for rows.Next() {
+		var level GridLevel
+		if err := rows.Scan(&level.Index, &level.Price, &level.Side, &level.OrderID); err != nil {
+			return GridState{}, nil, err
+		}
+		levels = append(levels, level)
+	}
+	return state, levels, rows.Err()
+}
+
+// SaveGrid полностью заменяет сохранённую сетку
+func (r *SQLiteGridRepository) SaveGrid(ctx context.Context, state GridState, levels []GridLevel) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT OR REPLACE INTO grid_state (
+            id, symbol, lower_price, upper_price, levels, config_lower, config_upper, updated_at
+        ) VALUES (1, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+    `, state.Symbol, state.LowerPrice, state.UpperPrice, state.Levels, state.ConfigLower, state.ConfigUpper)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM grid_levels"); err != nil {
+		return err
+	}
+	for _, level := range levels {
+		_, err := tx.ExecContext(ctx, "INSERT INTO grid_levels (level, price, side, order_id) VALUES (?, ?, ?, ?)",
+			level.Index, level.Price, level.Side, level.OrderID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UpdateLevel обновляет сторону и ордер одного уровня
+func (r *SQLiteGridRepository) UpdateLevel(ctx context.Context, level GridLevel) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE grid_levels SET side = ?, order_id = ? WHERE level = ?",
+		level.Side, level.OrderID, level.Index)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errors.New("grid level not found")
+	}
+	return nil
+}
@@ -0,0 +1,438 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrLotNotFound = errors.New("lot not found")
+
+// Состояния лота
+const (
+	LotNew        = "NEW"         // покупка выставлена
+	LotFilled     = "FILLED"      // покупка исполнена, продажи нет
+	LotSellPlaced = "SELL_PLACED" // стоит ордер на продажу
+	LotClosed     = "CLOSED"      // продажа исполнена
+	LotCanceled   = "CANCELED"    // покупка отменена без исполнения
+)
+
+const lotsSchema = `
+CREATE TABLE IF NOT EXISTS lots
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol        TEXT,
+    buy_order_id  TEXT,
+    buy_price     REAL,
+    buy_qty       REAL,
+    buy_fee       REAL DEFAULT 0,
+    sell_order_id TEXT DEFAULT '',
+    sell_price    REAL DEFAULT 0,
+    sell_qty      REAL DEFAULT 0,
+    sell_fee      REAL DEFAULT 0,
+    state         TEXT,
+    profit        REAL DEFAULT 0,
+    stop_out      INTEGER DEFAULT 0,
+    stop_out_at   TIMESTAMP,
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    closed_at     TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS lots_buy_order_id ON lots (buy_order_id);
+CREATE INDEX IF NOT EXISTS lots_sell_order_id ON lots (sell_order_id);
+CREATE INDEX IF NOT EXISTS lots_state ON lots (state);
+`
+
+// Lot - связка покупки и продажи, которая её закрывает
+type Lot struct {
+	ID          int64
+	Symbol      string
+	BuyOrderID  string
+	BuyPrice    float64
+	BuyQty      float64
+	BuyFee      float64 // комиссия покупки в USDT
+	SellOrderID string
+	SellPrice   float64
+	SellQty     float64
+	SellFee     float64 // комиссия продажи в USDT
+	State       string
+	Profit      float64 // реализованная прибыль за вычетом комиссий
+	StopOut     bool    // продажа - выход по стоп-лоссу
+	CreatedAt   string
+	UpdatedAt   string
+	ClosedAt    string
+}
+
+// CreatedTime - время создания лота (драйвер отдаёт RFC3339 или "YYYY-MM-DD HH:MM:SS")
+func (l Lot) CreatedTime() time.Time {
+	for _, layout := range []string{time.RFC3339, time.DateTime} {
+		if t, err := time.Parse(layout, l.CreatedAt); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
+
+// LotRepository определяет интерфейс журнала позиций
+type LotRepository interface {
+	CreateLot(ctx context.Context, lot Lot) (int64, error)
+	GetLotsByOrderID(ctx context.Context, orderID string) ([]Lot, error)
+	GetLotsByState(ctx context.Context, states ...string) ([]Lot, error)
+	GetLotsUpdatedSince(ctx context.Context, since time.Time, states ...string) ([]Lot, error)
+	MarkBuyFilled(ctx context.Context, buyOrderID string, price, qty float64) error
+	MarkBuyCanceled(ctx context.Context, buyOrderID string) error
+	SetSellOrder(ctx context.Context, buyOrderID, sellOrderID string, price float64) error
+	ReplaceSellOrder(ctx context.Context, oldSellOrderID, newSellOrderID string, price float64) error
+	MarkSellFilled(ctx context.Context, sellOrderID string, price, qty float64) error
+	MarkSellPartFilled(ctx context.Context, sellOrderID string, price, qty float64) error
+	ReopenLot(ctx context.Context, sellOrderID string) error
+	MarkStopOut(ctx context.Context, sellOrderID string) error
+	StopOuts(ctx context.Context, since time.Time) (int, float64, error)
+	CoveredQty(ctx context.Context, buyOrderID string) (float64, error)
+	RealizedProfit(ctx context.Context, since time.Time) (float64, error)
+	RealizedFees(ctx context.Context, since time.Time) (float64, error)
+	SetBuyFee(ctx context.Context, buyOrderID string, fee float64) error
+	SetSellFee(ctx context.Context, sellOrderID string, fee float64) error
+}
+
+// SQLiteLotRepository реализует LotRepository с использованием SQLite
+type SQLiteLotRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteLotRepository создает журнал позиций и таблицу, если её нет
+func NewSQLiteLotRepository(db *sql.DB) (*SQLiteLotRepository, error) {
+	if _, err := db.Exec(lotsSchema); err != nil {
+		return nil, err
+	}
+	// журнал прошлых версий создан без отметки выхода по стопу
+	if err := addColumn(db, "lots", "stop_out", "INTEGER DEFAULT 0"); err != nil {
+		return nil, err
+	}
+	if err := addColumn(db, "lots", "stop_out_at", "TIMESTAMP"); err != nil {
+		return nil, err
+	}
+	return &SQLiteLotRepository{db: db}, nil
+}
+
+// addColumn - добавляет колонку в таблицу, если её нет
+func addColumn(db *sql.DB, table, column, definition string) error {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+const lotColumns = `
+        id, symbol, buy_order_id, buy_price, buy_qty, buy_fee,
+        sell_order_id, sell_price, sell_qty, sell_fee, state, profit, stop_out,
+        created_at, updated_at, COALESCE(closed_at, '')
+`
+
+// CreateLot добавляет новый лот
+func (r *SQLiteLotRepository) CreateLot(ctx context.Context, lot Lot) (int64, error) {
+	if lot.State == "" {
+		lot.State = LotNew
+	}
+	result, err := r.db.ExecContext(ctx, `
+        INSERT INTO lots (
+            symbol, buy_order_id, buy_price, buy_qty, buy_fee,
+            sell_order_id, sell_price, sell_qty, sell_fee, state
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, lot.Symbol, lot.BuyOrderID, lot.BuyPrice, lot.BuyQty, lot.BuyFee,
+		lot.SellOrderID, lot.SellPrice, lot.SellQty, lot.SellFee, lot.State)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetLotsByOrderID ищет лоты по ордеру на покупку или на продажу
+func (r *SQLiteLotRepository) GetLotsByOrderID(ctx context.Context, orderID string) ([]Lot, error) {
+	return r.query(ctx, "SELECT "+lotColumns+" FROM lots WHERE buy_order_id = ? OR sell_order_id = ? ORDER BY id", orderID, orderID)
+}
+
+// GetLotsByState возвращает лоты в указанных состояниях
+func (r *SQLiteLotRepository) GetLotsByState(ctx context.Context, states ...string) ([]Lot, error) {
+	if len(states) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(states))
+	for i, s := range states {
+		args[i] = s
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(states)), ",")
+	return r.query(ctx, "SELECT "+lotColumns+" FROM lots WHERE state IN ("+placeholders+") ORDER BY id", args...)
+}
+
+// GetLotsUpdatedSince возвращает лоты в указанных состояниях, изменённые начиная с since
+func (r *SQLiteLotRepository) GetLotsUpdatedSince(ctx context.Context, since time.Time, states ...string) ([]Lot, error) {
+	if len(states) == 0 {
+		return nil, nil
+	}
+	// updated_at пишется CURRENT_TIMESTAMP в UTC
+	args := []any{since.UTC().Format(time.DateTime)}
+	for _, s := range states {
+		args = append(args, s)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(states)), ",")
+	return r.query(ctx, "SELECT "+lotColumns+" FROM lots WHERE updated_at >= ? AND state IN ("+placeholders+") ORDER BY id", args...)
+}
+
+// MarkBuyFilled фиксирует исполнение покупки. Если покупка не была записана
+// (например, исполнение найдено после перезапуска), создаёт лот
+func (r *SQLiteLotRepository) MarkBuyFilled(ctx context.Context, buyOrderID string, price, qty float64) error {
+	result, err := r.db.ExecContext(ctx, `
+        UPDATE lots SET buy_price = ?, buy_qty = ?, state = ?, updated_at = CURRENT_TIMESTAMP
+        WHERE buy_order_id = ? AND state IN (?, ?)
+    `, price, qty, LotFilled, buyOrderID, LotNew, LotFilled)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		_, err = r.CreateLot(ctx, Lot{BuyOrderID: buyOrderID, BuyPrice: price, BuyQty: qty, State: LotFilled})
+	}
+	return err
+}
+
+// MarkBuyCanceled отмечает неисполненную покупку как отменённую
+func (r *SQLiteLotRepository) MarkBuyCanceled(ctx context.Context, buyOrderID string) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE lots SET state = ?, updated_at = CURRENT_TIMESTAMP
+        WHERE buy_order_id = ? AND state = ?
+    `, LotCanceled, buyOrderID, LotNew)
+	return err
+}
+
+// SetSellOrder привязывает ордер на продажу к исполненной покупке
+func (r *SQLiteLotRepository) SetSellOrder(ctx context.Context, buyOrderID, sellOrderID string, price float64) error {
+	return r.exec(ctx, `
+        UPDATE lots SET sell_order_id = ?, sell_price = ?, state = ?, updated_at = CURRENT_TIMESTAMP
+        WHERE buy_order_id = ? AND state = ?
+    `, sellOrderID, price, LotSellPlaced, buyOrderID, LotFilled)
+}
+
+// ReplaceSellOrder переносит лоты на новый ордер на продажу (трейлинг, стоп, перестановка)
+func (r *SQLiteLotRepository) ReplaceSellOrder(ctx context.Context, oldSellOrderID, newSellOrderID string, price float64) error {
+	return r.exec(ctx, `
+        UPDATE lots SET sell_order_id = ?, sell_price = ?, updated_at = CURRENT_TIMESTAMP
+        WHERE sell_order_id = ? AND state = ?
+    `, newSellOrderID, price, oldSellOrderID, LotSellPlaced)
+}
+
+// MarkSellFilled закрывает лоты ордера на продажу и считает прибыль
+func (r *SQLiteLotRepository) MarkSellFilled(ctx context.Context, sellOrderID string, price, qty float64) error {
+	lots, err := r.query(ctx, "SELECT "+lotColumns+" FROM lots WHERE sell_order_id = ? AND state = ?", sellOrderID, LotSellPlaced)
+	if err != nil {
+		return err
+	}
+	if len(lots) == 0 {
+		return ErrLotNotFound
+	}
+
+	// Исполненный объём делим между лотами пропорционально их объёму
+	var totalQty float64
+	for _, lot := range lots {
+		totalQty += lot.BuyQty
+	}
+	for _, lot := range lots {
+		lotQty := lot.BuyQty
+		if totalQty > 0 && qty > 0 {
+			lotQty = qty * lot.BuyQty / totalQty
+		}
+		profit := price*lotQty - lot.SellFee - (lot.BuyPrice*lotQty + lot.BuyFee)
+		_, err := r.db.ExecContext(ctx, `
+            UPDATE lots SET sell_price = ?, sell_qty = ?, profit = ?, state = ?,
+                updated_at = CURRENT_TIMESTAMP, closed_at = CURRENT_TIMESTAMP
+            WHERE id = ?
+        `, price, lotQty, profit, LotClosed, lot.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkSellPartFilled закрывает исполненную часть снятой продажи (выход по стопу или трейлингу).
+// От каждого лота продажи отделяется закрытый лот на его долю qty вместе с комиссией продажи,
+// остаток остаётся на продаже до переноса на новую. Если продано всё - то же, что MarkSellFilled
+func (r *SQLiteLotRepository) MarkSellPartFilled(ctx context.Context, sellOrderID string, price, qty float64) error {
+	lots, err := r.query(ctx, "SELECT "+lotColumns+" FROM lots WHERE sell_order_id = ? AND state = ?", sellOrderID, LotSellPlaced)
+	if err != nil {
+		return err
+	}
+	if len(lots) == 0 {
+		return ErrLotNotFound
+	}
+	var totalQty float64
+	for _, lot := range lots {
+		totalQty += lot.BuyQty
+	}
+	if qty <= 0 {
+		return nil
+	}
+	if qty >= totalQty {
+		return r.MarkSellFilled(ctx, sellOrderID, price, qty)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, lot := range lots {
+		soldQty := qty * lot.BuyQty / totalQty
+		buyFee := lot.BuyFee * soldQty / lot.BuyQty
+		profit := price*soldQty - lot.SellFee - (lot.BuyPrice*soldQty + buyFee)
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO lots (
+                symbol, buy_order_id, buy_price, buy_qty, buy_fee,
+                sell_order_id, sell_price, sell_qty, sell_fee, state, profit, stop_out, stop_out_at,
+                created_at, updated_at, closed_at
+            )
+            SELECT symbol, buy_order_id, buy_price, ?, ?, sell_order_id, ?, ?, sell_fee, ?, ?, stop_out, stop_out_at,
+                created_at, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+            FROM lots WHERE id = ?
+        `, soldQty, buyFee, price, soldQty, LotClosed, profit, lot.ID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+            UPDATE lots SET buy_qty = buy_qty - ?, buy_fee = buy_fee - ?, sell_fee = 0, updated_at = CURRENT_TIMESTAMP
+            WHERE id = ?
+        `, soldQty, buyFee, lot.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ReopenLot возвращает лоты отменённой продажи в состояние FILLED (монеты не проданы)
+func (r *SQLiteLotRepository) ReopenLot(ctx context.Context, sellOrderID string) error {
+	return r.exec(ctx, `
+        UPDATE lots SET sell_order_id = '', sell_price = 0, stop_out = 0, stop_out_at = NULL, state = ?,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE sell_order_id = ? AND state = ?
+    `, LotFilled, sellOrderID, LotSellPlaced)
+}
+
+// MarkStopOut отмечает лоты продажи как выход по стоп-лоссу и запоминает время выхода.
+// Отметка снимается, если лоты вернулись без продажи
+func (r *SQLiteLotRepository) MarkStopOut(ctx context.Context, sellOrderID string) error {
+	return r.exec(ctx, `
+        UPDATE lots SET stop_out = 1, stop_out_at = COALESCE(stop_out_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+        WHERE sell_order_id = ? AND state = ?
+    `, sellOrderID, LotSellPlaced)
+}
+
+// StopOuts - выходы по стоп-лоссу начиная с since и результат закрытых (убыток - отрицательный).
+// Выход считается по ордеру продажи в день выхода, закрыт он или ещё стоит на бирже
+func (r *SQLiteLotRepository) StopOuts(ctx context.Context, since time.Time) (int, float64, error) {
+	var count int
+	var profit float64
+	// stop_out_at пишется CURRENT_TIMESTAMP в UTC
+	err := r.db.QueryRowContext(ctx, `
+        SELECT COUNT(DISTINCT sell_order_id), COALESCE(SUM(CASE WHEN state = ? THEN profit ELSE 0 END), 0)
+        FROM lots
+        WHERE stop_out = 1 AND stop_out_at >= ? AND state IN (?, ?)
+    `, LotClosed, since.UTC().Format(time.DateTime), LotClosed, LotSellPlaced).Scan(&count, &profit)
+	return count, profit, err
+}
+
+// CoveredQty - сколько купленного по ордеру уже выставлено на продажу или продано.
+// Частичные исполнения покупки записываются отдельными лотами с тем же buy_order_id
+func (r *SQLiteLotRepository) CoveredQty(ctx context.Context, buyOrderID string) (float64, error) {
+	var qty float64
+	err := r.db.QueryRowContext(ctx, `
+        SELECT COALESCE(SUM(buy_qty), 0) FROM lots WHERE buy_order_id = ? AND state IN (?, ?)
+    `, buyOrderID, LotSellPlaced, LotClosed).Scan(&qty)
+	return qty, err
+}
+
+// RealizedProfit - сумма прибыли закрытых лотов начиная с since (убыток - отрицательная)
+func (r *SQLiteLotRepository) RealizedProfit(ctx context.Context, since time.Time) (float64, error) {
+	var profit float64
+	// closed_at пишется CURRENT_TIMESTAMP в UTC
+	err := r.db.QueryRowContext(ctx, `
+        SELECT COALESCE(SUM(profit), 0) FROM lots WHERE state = ? AND closed_at >= ?
+    `, LotClosed, since.UTC().Format(time.DateTime)).Scan(&profit)
+	return profit, err
+}
+
+// RealizedFees - сумма комиссий закрытых лотов начиная с since
+func (r *SQLiteLotRepository) RealizedFees(ctx context.Context, since time.Time) (float64, error) {
+	var fees float64
+	err := r.db.QueryRowContext(ctx, `
+        SELECT COALESCE(SUM(buy_fee + sell_fee), 0) FROM lots WHERE state = ? AND closed_at >= ?
+    `, LotClosed, since.UTC().Format(time.DateTime)).Scan(&fees)
+	return fees, err
+}
+
+// SetBuyFee - комиссия покупки в USDT, делится между лотами ордера пропорционально объёму
+func (r *SQLiteLotRepository) SetBuyFee(ctx context.Context, buyOrderID string, fee float64) error {
+	return r.exec(ctx, `
+        UPDATE lots SET buy_fee = ? * buy_qty / (
+            SELECT SUM(buy_qty) FROM lots WHERE buy_order_id = ? AND state != ?
+        ), updated_at = CURRENT_TIMESTAMP
+        WHERE buy_order_id = ? AND state != ?
+    `, fee, buyOrderID, LotCanceled, buyOrderID, LotCanceled)
+}
+
+// SetSellFee - комиссия продажи в USDT, делится между лотами ордера пропорционально объёму
+func (r *SQLiteLotRepository) SetSellFee(ctx context.Context, sellOrderID string, fee float64) error {
+	return r.exec(ctx, `
+        UPDATE lots SET sell_fee = ? * buy_qty / (
+            SELECT SUM(buy_qty) FROM lots WHERE sell_order_id = ? AND state = ?
+        ), updated_at = CURRENT_TIMESTAMP
+        WHERE sell_order_id = ? AND state = ?
+    `, fee, sellOrderID, LotSellPlaced, sellOrderID, LotSellPlaced)
+}
+
+func (r *SQLiteLotRepository) exec(ctx context.Context, query string, args ...any) error {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrLotNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteLotRepository) query(ctx context.Context, query string, args ...any) ([]Lot, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []Lot
+	for rows.Next() {
+		var lot Lot
+		if err := rows.Scan(
+			&lot.ID, &lot.Symbol, &lot.BuyOrderID, &lot.BuyPrice, &lot.BuyQty, &lot.BuyFee,
+			&lot.SellOrderID, &lot.SellPrice, &lot.SellQty, &lot.SellFee, &lot.State, &lot.Profit, &lot.StopOut,
+			&lot.CreatedAt, &lot.UpdatedAt, &lot.ClosedAt,
+		); err != nil {
+			return nil, err
+		}
+		lots = append(lots, lot)
+	}
+	return lots, rows.Err()
+}
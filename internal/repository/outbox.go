@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrIntentNotFound = errors.New("intent not found")
+
+// Виды намерений
+const (
+	IntentSell    = "SELL"    // продажа для покупки buy_order_id
+	IntentReplace = "REPLACE" // продажа взамен снятой продажи order_id (стоп, трейлинг)
+	IntentOrder   = "ORDER"   // ордер воркера со своим хранилищем (сетка, DCA)
+	IntentBuy     = "BUY"     // покупка buy_v1 или лесенки, отслеживаемая через журнал лотов
+	IntentCancel  = "CANCEL"  // отмена ордера order_id
+)
+
+// Состояния намерения
+const (
+	IntentPending = "PENDING" // записано, биржа ещё не подтвердила
+	IntentDone    = "DONE"    // биржа подтвердила
+	IntentFailed  = "FAILED"  // биржа отклонила или ордер так и не был отправлен
+)
+
+const outboxSchema = `
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind            TEXT,
+    client_order_id TEXT DEFAULT '',
+    buy_order_id    TEXT DEFAULT '',
+    order_id        TEXT DEFAULT '',
+    buy_price       REAL DEFAULT 0,
+    price           REAL DEFAULT 0,
+    qty             REAL DEFAULT 0,
+    state           TEXT,
+    error           TEXT DEFAULT '',
+    created_at      TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS outbox_state ON outbox (state);
+`
+
+// Intent - ордер, который бот собирается отправить на биржу. Записывается до отправки,
+// чтобы после падения процесса было видно, что не дошло до журнала
+type Intent struct {
+	ID            int64
+	Kind          string
+	ClientOrderID string  // client order ID ордера
+	BuyOrderID    string  // покупка, для которой продажа
+	OrderID       string  // созданный ордер, отменяемый ордер или заменяемая продажа
+	BuyPrice      float64 // цена покупки для повторной продажи
+	Price         float64
+	Qty           float64
+	State         string
+	Error         string
+	CreatedAt     string
+}
+
+// OutboxRepository определяет интерфейс журнала намерений
+type OutboxRepository interface {
+	AddIntent(ctx context.Context, intent Intent) (int64, error)
+	SetClientOrderID(ctx context.Context, id int64, clientOrderID string) error
+	MarkIntentDone(ctx context.Context, id int64, orderID string) error
+	MarkIntentFailed(ctx context.Context, id int64, reason string) error
+	PendingIntents(ctx context.Context) ([]Intent, error)
+	PruneIntents(ctx context.Context, before time.Time) error
+}
+
+// SQLiteOutboxRepository реализует OutboxRepository с использованием SQLite
+type SQLiteOutboxRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteOutboxRepository создает журнал намерений и таблицу, если её нет
+func NewSQLiteOutboxRepository(db *sql.DB) (*SQLiteOutboxRepository, error) {
+	if _, err := db.Exec(outboxSchema); err != nil {
+		return nil, err
+	}
+	return &SQLiteOutboxRepository{db: db}, nil
+}
+
+// AddIntent записывает намерение в состоянии PENDING
+func (r *SQLiteOutboxRepository) AddIntent(ctx context.Context, intent Intent) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+        INSERT INTO outbox (kind, client_order_id, buy_order_id, order_id, buy_price, price, qty, state)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `, intent.Kind, intent.ClientOrderID, intent.BuyOrderID, intent.OrderID,
+		intent.BuyPrice, intent.Price, intent.Qty, IntentPending)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// SetClientOrderID задаёт client order ID перед отправкой ордера
+func (r *SQLiteOutboxRepository) SetClientOrderID(ctx context.Context, id int64, clientOrderID string) error {
+	return r.exec(ctx, `
+        UPDATE outbox SET client_order_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND state = ?
+    `, clientOrderID, id, IntentPending)
+}
+
+// MarkIntentDone отмечает намерение выполненным
+func (r *SQLiteOutboxRepository) MarkIntentDone(ctx context.Context, id int64, orderID string) error {
+	return r.exec(ctx, `
+        UPDATE outbox SET order_id = ?, state = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND state = ?
+    `, orderID, IntentDone, id, IntentPending)
+}
+
+// MarkIntentFailed отмечает намерение невыполненным с причиной
+func (r *SQLiteOutboxRepository) MarkIntentFailed(ctx context.Context, id int64, reason string) error {
+	return r.exec(ctx, `
+        UPDATE outbox SET error = ?, state = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND state = ?
+    `, reason, IntentFailed, id, IntentPending)
+}
+
+// PendingIntents возвращает неподтверждённые намерения в порядке записи
+func (r *SQLiteOutboxRepository) PendingIntents(ctx context.Context) ([]Intent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, kind, client_order_id, buy_order_id, order_id, buy_price, price, qty, state, error, created_at
+        FROM outbox WHERE state = ? ORDER BY id
+    `, IntentPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var intents []Intent
+	for rows.Next() {
+		var intent Intent
+		if err := rows.Scan(
+			&intent.ID, &intent.Kind, &intent.ClientOrderID, &intent.BuyOrderID, &intent.OrderID,
+			&intent.BuyPrice, &intent.Price, &intent.Qty, &intent.State, &intent.Error, &intent.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		intents = append(intents, intent)
+	}
+	return intents, rows.Err()
+}
+
+// PruneIntents удаляет выполненные и отклонённые намерения старше before
+func (r *SQLiteOutboxRepository) PruneIntents(ctx context.Context, before time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+        DELETE FROM outbox WHERE state != ? AND updated_at < ?
+    `, IntentPending, before.UTC().Format(time.DateTime))
+	return err
+}
+
+func (r *SQLiteOutboxRepository) exec(ctx context.Context, query string, args ...any) error {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrIntentNotFound
+	}
+	return nil
+}
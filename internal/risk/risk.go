@@ -0,0 +1,257 @@
+// Package risk - лимиты капитала и риска, которые проверяются перед каждой покупкой.
+// Guard оборачивает биржу, поэтому лимиты действуют для всех воркеров и команд Telegram
+package risk
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/logger"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/tools"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertInterval - как часто повторять в Telegram одну и ту же причину блокировки
+const alertInterval = 30 * time.Minute
+
+// Manager - проверка лимитов риска. Продажи уменьшают риск и не ограничиваются
+type Manager struct {
+	cfg      config.Config
+	exchange exchange.Exchange
+	lots     repository.LotRepository
+	logger   logger.Logger
+
+	mu      sync.Mutex
+	buys    []time.Time          // время размещения покупок за последний час
+	alerted map[string]time.Time // когда последний раз сообщали о лимите
+}
+
+// NewManager - конструктор. ex - биржа без обёртки
+func NewManager(cfg config.Config, ex exchange.Exchange, lots repository.LotRepository, logLogger logger.Logger) *Manager {
+	return &Manager{
+		cfg:      cfg,
+		exchange: ex,
+		lots:     lots,
+		logger:   logLogger,
+		alerted:  make(map[string]time.Time),
+	}
+}
+
+// batch - покупки пачки, которые прошли проверку, но ещё не отправлены на биржу
+type batch struct {
+	count int     // покупок
+	quote float64 // сумма в USDT
+	base  float64 // объём в монетах
+}
+
+// Check - проверяет ордер перед размещением. Нарушение лимита возвращает exchange.ErrBlocked с причиной
+func (m *Manager) Check(ctx context.Context, req exchange.SpotOrderRequest) error {
+	return m.check(ctx, req, batch{})
+}
+
+// check - проверка с учётом pending покупок, ещё не отправленных в той же пачке
+func (m *Manager) check(ctx context.Context, req exchange.SpotOrderRequest, pending batch) error {
+	if req.Side != exchange.Buy {
+		return nil
+	}
+	limits := m.cfg.Risk
+
+	if limits.MaxBuysPerHour > 0 {
+		if count := m.buysLastHour() + pending.count; count >= limits.MaxBuysPerHour {
+			return m.block("buys_per_hour", fmt.Sprintf("покупок за час %d, лимит %d", count, limits.MaxBuysPerHour))
+		}
+	}
+
+	if limits.MaxDailyLoss > 0 {
+		profit, err := m.lots.RealizedProfit(ctx, tools.StartOfDay(time.Now()))
+		if err != nil {
+			return fmt.Errorf("ошибка расчёта дневного результата: %w", err)
+		}
+		if -profit >= limits.MaxDailyLoss {
+			return m.block("daily_loss", fmt.Sprintf("убыток за день %.4f USDT, лимит %.4f", -profit, limits.MaxDailyLoss))
+		}
+	}
+
+	if limits.MaxOpenBuys > 0 || limits.MaxQuoteCapital > 0 {
+		openOrders, err := m.exchange.GetOpenOrders(ctx, req.Symbol)
+		if err != nil {
+			return err
+		}
+		if limits.MaxOpenBuys > 0 {
+			openBuys := pending.count
+			for _, order := range openOrders {
+				if order.Side == exchange.Buy {
+					openBuys++
+				}
+			}
+			if openBuys >= limits.MaxOpenBuys {
+				return m.block("open_buys", fmt.Sprintf("открытых покупок %d, лимит %d", openBuys, limits.MaxOpenBuys))
+			}
+		}
+		if limits.MaxQuoteCapital > 0 {
+			notional, err := m.notional(ctx, req)
+			if err != nil {
+				return err
+			}
+			inUse, err := tools.CapitalInUse(ctx, openOrders, m.lots, m.cfg.ProfitPercent)
+			if err != nil {
+				return fmt.Errorf("ошибка расчёта капитала в работе: %w", err)
+			}
+			inUse += pending.quote
+			if inUse+notional > limits.MaxQuoteCapital {
+				return m.block("quote_capital", fmt.Sprintf("капитал в работе %.2f + %.2f USDT, лимит %.2f", inUse, notional, limits.MaxQuoteCapital))
+			}
+		}
+	}
+
+	if limits.MaxBaseInventory > 0 {
+		accountInfo, err := m.exchange.GetAccountInfo(ctx)
+		if err != nil {
+			return err
+		}
+		inventory, err := accountInfo.GetTotalBalance(baseAsset(req.Symbol))
+		if err != nil {
+			return err
+		}
+		inventory += pending.base
+		if inventory+req.Quantity > limits.MaxBaseInventory {
+			return m.block("base_inventory", fmt.Sprintf("монет на балансе %.8f + %.8f, лимит %.8f", inventory, req.Quantity, limits.MaxBaseInventory))
+		}
+	}
+	return nil
+}
+
+// Record - учёт размещённой покупки для лимита покупок в час
+func (m *Manager) Record(req exchange.SpotOrderRequest) {
+	if req.Side != exchange.Buy {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buys = append(m.buys, time.Now())
+}
+
+func (m *Manager) buysLastHour() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cutoff := time.Now().Add(-time.Hour)
+	i := 0
+	for i < len(m.buys) && m.buys[i].Before(cutoff) {
+		i++
+	}
+	m.buys = m.buys[i:]
+	return len(m.buys)
+}
+
+// notional - сумма ордера в USDT, для рыночного ордера по текущей цене
+func (m *Manager) notional(ctx context.Context, req exchange.SpotOrderRequest) (float64, error) {
+	price := req.Price
+	if price == 0 {
+		var err error
+		price, err = m.exchange.GetPrice(ctx, req.Symbol)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return price * req.Quantity, nil
+}
+
+// block - логирует причину блокировки и при alert сообщает в Telegram не чаще alertInterval
+func (m *Manager) block(limit, reason string) error {
+	log.Printf("Покупка заблокирована: %s", reason)
+	if m.cfg.Risk.Alert {
+		m.mu.Lock()
+		last, ok := m.alerted[limit]
+		notify := !ok || time.Since(last) > alertInterval
+		if notify {
+			m.alerted[limit] = time.Now()
+		}
+		m.mu.Unlock()
+		if notify {
+			m.logger.Notify(fmt.Sprintf("Покупки заблокированы лимитом риска: %s", reason))
+		}
+	}
+	return fmt.Errorf("%w лимитами риска: %s", exchange.ErrBlocked, reason)
+}
+
+// baseAsset - базовая валюта пары, например KAS для KASUSDT
+func baseAsset(symbol string) string {
+	return strings.TrimSuffix(symbol, "USDT")
+}
+
+// Guard - биржа, которая проверяет лимиты риска перед каждым ордером
+type Guard struct {
+	exchange.Exchange
+	manager *Manager
+
+	// покупки размещаются по одной, чтобы два воркера не прошли проверку одновременно
+	buyMu sync.Mutex
+}
+
+// NewGuard - обёртка над биржей
+func NewGuard(ex exchange.Exchange, manager *Manager) *Guard {
+	return &Guard{Exchange: ex, manager: manager}
+}
+
+// PlaceOrder - размещение ордера после проверки лимитов
+func (g *Guard) PlaceOrder(ctx context.Context, req exchange.SpotOrderRequest) (*exchange.OrderResponse, error) {
+	if req.Side == exchange.Buy {
+		g.buyMu.Lock()
+		defer g.buyMu.Unlock()
+	}
+	if err := g.manager.Check(ctx, req); err != nil {
+		return nil, err
+	}
+	orderResp, err := g.Exchange.PlaceOrder(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	g.manager.Record(req)
+	return orderResp, nil
+}
+
+// PlaceBatchOrders - размещение пачки ордеров. Покупки проверяются по одной,
+// размещаются только прошедшие проверку до первой заблокированной.
+// В лимите покупок в час учитываются только ордера, которые биржа приняла
+func (g *Guard) PlaceBatchOrders(ctx context.Context, reqs []exchange.SpotOrderRequest) ([]exchange.OrderResponse, error) {
+	g.buyMu.Lock()
+	defer g.buyMu.Unlock()
+
+	allowed := make([]exchange.SpotOrderRequest, 0, len(reqs))
+	var pending batch
+	var blockErr error
+	for _, req := range reqs {
+		// покупки пачки перед этой ещё не размещены, но займут место во всех лимитах
+		if err := g.manager.check(ctx, req, pending); err != nil {
+			blockErr = err
+			break
+		}
+		allowed = append(allowed, req)
+		if req.Side != exchange.Buy {
+			continue
+		}
+		notional, err := g.manager.notional(ctx, req)
+		if err != nil {
+			blockErr = err
+			break
+		}
+		pending.count++
+		pending.quote += notional
+		pending.base += req.Quantity
+	}
+	if len(allowed) == 0 {
+		return nil, blockErr
+	}
+	responses, err := g.Exchange.PlaceBatchOrders(ctx, allowed)
+	for i, orderResp := range responses {
+		if i < len(allowed) && orderResp.OrderID != "" {
+			g.manager.Record(allowed[i])
+		}
+	}
+	return responses, err
+}
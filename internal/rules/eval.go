@@ -0,0 +1,246 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/indicator"
+)
+
+// klinesLimit - сколько свечей запрашивать для расчёта индикаторов
+// (EMA сходится за несколько своих периодов)
+const klinesLimit = 300
+
+// Source - откуда правила берут рыночные данные
+type Source interface {
+	GetPrice(ctx context.Context, symbol string) (float64, error)
+	GetKlines(ctx context.Context, symbol, interval string, limit int) ([]exchange.Kline, error)
+	GetTicker24h(ctx context.Context, symbol string) (*exchange.Ticker24h, error)
+}
+
+// env - кеш рыночных данных на время одной проверки правил
+type env struct {
+	symbol    string
+	source    Source
+	price     *float64
+	change24h *float64
+	klines    map[string][]exchange.Kline
+}
+
+func newEnv(symbol string, source Source) *env {
+	return &env{symbol: symbol, source: source, klines: make(map[string][]exchange.Kline)}
+}
+
+func (e *env) getPrice(ctx context.Context) (float64, error) {
+	if e.price == nil {
+		price, err := e.source.GetPrice(ctx, e.symbol)
+		if err != nil {
+			return 0, err
+		}
+		e.price = &price
+	}
+	return *e.price, nil
+}
+
+func (e *env) getChange24h(ctx context.Context) (float64, error) {
+	if e.change24h == nil {
+		ticker, err := e.source.GetTicker24h(ctx, e.symbol)
+		if err != nil {
+			return 0, err
+		}
+		change, err := ticker.ChangePercent()
+		if err != nil {
+			return 0, err
+		}
+		e.change24h = &change
+	}
+	return *e.change24h, nil
+}
+
+func (e *env) getKlines(ctx context.Context, interval string) ([]exchange.Kline, error) {
+	if klines, ok := e.klines[interval]; ok {
+		return klines, nil
+	}
+	klines, err := e.source.GetKlines(ctx, e.symbol, interval, klinesLimit)
+	if err != nil {
+		return nil, err
+	}
+	if len(klines) == 0 {
+		return nil, fmt.Errorf("нет свечей для интервала %s", interval)
+	}
+	e.klines[interval] = klines
+	return klines, nil
+}
+
+type node interface {
+	eval(ctx context.Context, e *env) (bool, []string, error)
+}
+
+type orNode []andNode
+
+func (n orNode) eval(ctx context.Context, e *env) (bool, []string, error) {
+	var details []string
+	result := false
+	for _, and := range n {
+		ok, d, err := and.eval(ctx, e)
+		if err != nil {
+			return false, nil, err
+		}
+		details = append(details, d...)
+		result = result || ok
+	}
+	return result, details, nil
+}
+
+type andNode []*cmpNode
+
+func (n andNode) eval(ctx context.Context, e *env) (bool, []string, error) {
+	var details []string
+	result := true
+	for _, cmp := range n {
+		ok, d, err := cmp.eval(ctx, e)
+		if err != nil {
+			return false, nil, err
+		}
+		details = append(details, d...)
+		result = result && ok
+	}
+	return result, details, nil
+}
+
+type cmpNode struct {
+	left  operand
+	op    string
+	right operand
+}
+
+func (n *cmpNode) eval(ctx context.Context, e *env) (bool, []string, error) {
+	l, err := n.left.value(ctx, e)
+	if err != nil {
+		return false, nil, fmt.Errorf("%s: %w", n.left, err)
+	}
+	r, err := n.right.value(ctx, e)
+	if err != nil {
+		return false, nil, fmt.Errorf("%s: %w", n.right, err)
+	}
+
+	var ok bool
+	switch n.op {
+	case "<":
+		ok = l < r
+	case "<=":
+		ok = l <= r
+	case ">":
+		ok = l > r
+	case ">=":
+		ok = l >= r
+	}
+	detail := fmt.Sprintf("%s=%s %s %s=%s", n.left, formatValue(l), n.op, n.right, formatValue(r))
+	if _, isNumber := n.right.(numberOperand); isNumber {
+		detail = fmt.Sprintf("%s=%s %s %s", n.left, formatValue(l), n.op, n.right)
+	}
+	return ok, []string{detail}, nil
+}
+
+type operand interface {
+	value(ctx context.Context, e *env) (float64, error)
+	String() string
+}
+
+type numberOperand struct {
+	v    float64
+	text string
+}
+
+func (n numberOperand) value(context.Context, *env) (float64, error) {
+	return n.v, nil
+}
+
+func (n numberOperand) String() string {
+	return n.text
+}
+
+type funcOperand struct {
+	name     string
+	args     []float64
+	interval string
+	text     string
+}
+
+func (f *funcOperand) String() string {
+	return f.text
+}
+
+func (f *funcOperand) value(ctx context.Context, e *env) (float64, error) {
+	switch f.name {
+	case "PRICE":
+		return e.getPrice(ctx)
+	case "CHANGE24H":
+		return e.getChange24h(ctx)
+	}
+
+	klines, err := e.getKlines(ctx, f.interval)
+	if err != nil {
+		return 0, err
+	}
+	last := klines[len(klines)-1]
+
+	var ind indicator.Indicator
+	switch f.name {
+	case "CLOSE":
+		return last.Close, nil
+	case "VOLUME":
+		return last.Volume, nil
+	case "SMA":
+		ind = indicator.NewSMA(int(f.args[0]))
+	case "EMA":
+		ind = indicator.NewEMA(int(f.args[0]))
+	case "RSI":
+		ind = indicator.NewRSI(int(f.args[0]))
+	case "ATR":
+		ind = indicator.NewATR(int(f.args[0]))
+	case "VWAP":
+		ind = indicator.NewVWAP(int(f.args[0]))
+	case "VOLMA":
+		ind = indicator.NewVolumeMA(int(f.args[0]))
+	case "BB_UPPER", "BB_LOWER":
+		bb := indicator.NewBollinger(int(f.args[0]), f.args[1])
+		indicator.Compute(bb, klines)
+		if !bb.Ready() {
+			return 0, fmt.Errorf("недостаточно свечей: %d", len(klines))
+		}
+		if f.name == "BB_UPPER" {
+			return bb.Upper(), nil
+		}
+		return bb.Lower(), nil
+	case "MACD", "MACD_SIGNAL", "MACD_HIST":
+		macd := indicator.NewMACD(int(f.args[0]), int(f.args[1]), int(f.args[2]))
+		indicator.Compute(macd, klines)
+		if !macd.Ready() {
+			return 0, fmt.Errorf("недостаточно свечей: %d", len(klines))
+		}
+		switch f.name {
+		case "MACD_SIGNAL":
+			return macd.Signal(), nil
+		case "MACD_HIST":
+			return macd.Histogram(), nil
+		}
+		return macd.Value(), nil
+	default:
+		return 0, fmt.Errorf("неизвестный индикатор %s", f.name)
+	}
+
+	v := indicator.Compute(ind, klines)
+	if !ind.Ready() {
+		return 0, fmt.Errorf("недостаточно свечей: %d", len(klines))
+	}
+	return v, nil
+}
+
+func formatValue(v float64) string {
+	s := fmt.Sprintf("%.8f", v)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
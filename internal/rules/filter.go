@@ -0,0 +1,83 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"scalpingbot/internal/config"
+)
+
+// Result - результат проверки одного правила
+type Result struct {
+	Rule    string
+	Pass    bool
+	Details []string // значения операндов, например "RSI(14,1m)=35.2 < 40"
+	Err     error
+}
+
+// String - строка для логов и Telegram
+func (r Result) String() string {
+	status := "OK"
+	if !r.Pass {
+		status = "FAIL"
+	}
+	if r.Err != nil {
+		return fmt.Sprintf("[%s] %s: ошибка: %v", status, r.Rule, r.Err)
+	}
+	return fmt.Sprintf("[%s] %s: %s", status, r.Rule, strings.Join(r.Details, ", "))
+}
+
+// Filter - набор правил входа из конфига, объединённых по mode (and/or)
+type Filter struct {
+	symbol string
+	source Source
+	mode   string
+	rules  []*Rule
+}
+
+// NewFilter - разбор правил из конфига
+func NewFilter(cfg config.Config, source Source) (*Filter, error) {
+	f := &Filter{
+		symbol: cfg.Symbol,
+		source: source,
+		mode:   strings.ToLower(cfg.EntryFilter.Mode),
+	}
+	for _, text := range cfg.EntryFilter.Rules {
+		rule, err := Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		f.rules = append(f.rules, rule)
+	}
+	return f, nil
+}
+
+// Len - количество правил
+func (f *Filter) Len() int {
+	return len(f.rules)
+}
+
+// Evaluate - проверка всех правил. Ошибка получения данных считается непройденным правилом
+func (f *Filter) Evaluate(ctx context.Context) (bool, []Result) {
+	if len(f.rules) == 0 {
+		return true, nil
+	}
+
+	e := newEnv(f.symbol, f.source)
+	results := make([]Result, 0, len(f.rules))
+	pass := f.mode != "or"
+	for _, rule := range f.rules {
+		ok, details, err := rule.root.eval(ctx, e)
+		if err != nil {
+			ok = false
+		}
+		results = append(results, Result{Rule: rule.String(), Pass: ok, Details: details, Err: err})
+		if f.mode == "or" {
+			pass = pass || ok
+		} else {
+			pass = pass && ok
+		}
+	}
+	return pass, results
+}
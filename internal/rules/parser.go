@@ -0,0 +1,181 @@
+// Package rules - декларативные правила входа вида "RSI(14,1m) < 40",
+// "close below EMA(50,5m)", "24h change > -8%" с комбинацией AND/OR
+package rules
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"scalpingbot/internal/exchange"
+	"strconv"
+	"strings"
+)
+
+const defaultInterval = "1m"
+
+var (
+	reOr         = regexp.MustCompile(`(?i)\s+or\s+`)
+	reAnd        = regexp.MustCompile(`(?i)\s+and\s+`)
+	reComparison = regexp.MustCompile(`(?i)^(.+?)\s*(<=|>=|<|>|\bbelow\b|\babove\b)\s*(.+)$`)
+	reNumber     = regexp.MustCompile(`^-?\d+(\.\d+)?%?$`)
+	reFunc       = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*(?:\((.*)\))?$`)
+	re24hChange  = regexp.MustCompile(`(?i)24h\s+change`)
+)
+
+// funcSpec - описание функции: количество числовых аргументов, сколько первых из них
+// периоды в свечах и нужен ли интервал свечей
+type funcSpec struct {
+	numArgs  int
+	periods  int
+	interval bool
+}
+
+var funcs = map[string]funcSpec{
+	"PRICE":       {0, 0, false},
+	"CHANGE24H":   {0, 0, false},
+	"CLOSE":       {0, 0, true},
+	"VOLUME":      {0, 0, true},
+	"SMA":         {1, 1, true},
+	"EMA":         {1, 1, true},
+	"RSI":         {1, 1, true},
+	"ATR":         {1, 1, true},
+	"VWAP":        {1, 1, true},
+	"VOLMA":       {1, 1, true},
+	"BB_UPPER":    {2, 1, true},
+	"BB_LOWER":    {2, 1, true},
+	"MACD":        {3, 3, true},
+	"MACD_SIGNAL": {3, 3, true},
+	"MACD_HIST":   {3, 3, true},
+}
+
+// Rule - разобранное правило
+type Rule struct {
+	text string
+	root node
+}
+
+// String - исходный текст правила
+func (r *Rule) String() string {
+	return r.text
+}
+
+// Parse - разбор правила. OR связывает группы, внутри которых условия через AND
+func Parse(text string) (*Rule, error) {
+	normalized := re24hChange.ReplaceAllString(strings.TrimSpace(text), "change24h")
+	if normalized == "" {
+		return nil, fmt.Errorf("пустое правило")
+	}
+
+	var or orNode
+	for _, orPart := range reOr.Split(normalized, -1) {
+		var and andNode
+		for _, part := range reAnd.Split(orPart, -1) {
+			cmp, err := parseComparison(strings.TrimSpace(part))
+			if err != nil {
+				return nil, fmt.Errorf("правило %q: %w", text, err)
+			}
+			and = append(and, cmp)
+		}
+		or = append(or, and)
+	}
+	return &Rule{text: text, root: or}, nil
+}
+
+func parseComparison(text string) (*cmpNode, error) {
+	m := reComparison.FindStringSubmatch(text)
+	if m == nil {
+		return nil, fmt.Errorf("не найдено сравнение в %q", text)
+	}
+
+	op := strings.ToLower(m[2])
+	switch op {
+	case "below":
+		op = "<"
+	case "above":
+		op = ">"
+	}
+
+	left, err := parseOperand(strings.TrimSpace(m[1]))
+	if err != nil {
+		return nil, err
+	}
+	right, err := parseOperand(strings.TrimSpace(m[3]))
+	if err != nil {
+		return nil, err
+	}
+	return &cmpNode{left: left, op: op, right: right}, nil
+}
+
+func parseOperand(text string) (operand, error) {
+	if reNumber.MatchString(text) {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(text, "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("некорректное число %q", text)
+		}
+		return numberOperand{v: v, text: text}, nil
+	}
+
+	m := reFunc.FindStringSubmatch(text)
+	if m == nil {
+		return nil, fmt.Errorf("некорректный операнд %q", text)
+	}
+	name := strings.ToUpper(m[1])
+	// close без интервала - текущая цена
+	if name == "CLOSE" && m[2] == "" {
+		name = "PRICE"
+	}
+	spec, ok := funcs[name]
+	if !ok {
+		return nil, fmt.Errorf("неизвестный индикатор %q", m[1])
+	}
+
+	f := &funcOperand{name: name, interval: defaultInterval, text: text}
+	var args []string
+	if strings.TrimSpace(m[2]) != "" {
+		args = strings.Split(m[2], ",")
+	}
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+	if spec.interval && len(args) == spec.numArgs+1 {
+		f.interval = args[spec.numArgs]
+		args = args[:spec.numArgs]
+	}
+	// неизвестный интервал всплыл бы только ошибкой биржи при проверке, и правило молча не проходило бы
+	if spec.interval && !exchange.ValidKlineInterval(f.interval) {
+		return nil, fmt.Errorf("%s: неизвестный интервал свечей %q, допустимые: %s", name, f.interval, exchange.KlineIntervals())
+	}
+	if len(args) != spec.numArgs {
+		return nil, fmt.Errorf("%s: ожидается аргументов: %d", name, spec.numArgs)
+	}
+	for i, arg := range args {
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("%s: некорректный аргумент %q", name, arg)
+		}
+		// дробный период иначе молча округлился бы конструктором индикатора
+		if i < spec.periods && (v != math.Trunc(v) || v > klinesLimit) {
+			return nil, fmt.Errorf("%s: период %q должен быть целым числом от 1 до %d", name, arg, klinesLimit)
+		}
+		f.args = append(f.args, v)
+	}
+	// индикатору, которому не хватает запрашиваемых свечей, правило не проходило бы никогда
+	if need := f.candles(); need > klinesLimit {
+		return nil, fmt.Errorf("%s: нужно свечей %d, запрашивается %d", name, need, klinesLimit)
+	}
+	return f, nil
+}
+
+// candles - сколько свечей нужно индикатору для готового значения
+func (f *funcOperand) candles() int {
+	switch f.name {
+	case "RSI", "ATR":
+		return int(f.args[0]) + 1
+	case "MACD", "MACD_SIGNAL", "MACD_HIST":
+		return max(int(f.args[0]), int(f.args[1])) + int(f.args[2]) - 1
+	}
+	if len(f.args) > 0 {
+		return int(f.args[0])
+	}
+	return 1
+}
@@ -0,0 +1,129 @@
+// Package schedule - расписание торговли: окна времени в заданном часовом поясе
+// и профили параметров (разрешены ли покупки, процент тейк-профита, таймаут, размер)
+package schedule
+
+import (
+	"fmt"
+	"log"
+	"scalpingbot/internal/config"
+	"sync"
+	"time"
+)
+
+// outsideName - имя профиля вне окон расписания
+const outsideName = "outside"
+
+// Profile - параметры, действующие сейчас. Незаданные в окне берутся из конфига
+type Profile struct {
+	Name           string
+	Buy            bool
+	ProfitPercent  float64
+	BaseBuyTimeout int
+	SizeMultiplier float64
+}
+
+// Schedule - выбор профиля по текущему времени
+type Schedule struct {
+	cfg     config.Config
+	loc     *time.Location
+	windows []window
+
+	mu   sync.Mutex
+	last string // имя последнего профиля, чтобы логировать смену
+}
+
+type window struct {
+	days       map[time.Weekday]bool
+	start, end int // минуты от полуночи, end не включительно
+	cfg        config.ScheduleWindow
+}
+
+// New - конструктор. При выключенном расписании всегда действует базовый профиль
+func New(cfg config.Config) (*Schedule, error) {
+	s := &Schedule{cfg: cfg, loc: time.UTC}
+	if !cfg.Schedule.Enabled {
+		return s, nil
+	}
+	loc, err := time.LoadLocation(cfg.Schedule.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	s.loc = loc
+	for _, w := range cfg.Schedule.Windows {
+		days, err := w.Weekdays()
+		if err != nil {
+			return nil, fmt.Errorf("окно %s: %w", w.Name, err)
+		}
+		start, end, err := w.Minutes()
+		if err != nil {
+			return nil, fmt.Errorf("окно %s: %w", w.Name, err)
+		}
+		s.windows = append(s.windows, window{days: days, start: start, end: end, cfg: w})
+	}
+	return s, nil
+}
+
+// Active - профиль на текущий момент
+func (s *Schedule) Active() Profile {
+	profile := s.At(time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if profile.Name != s.last {
+		if s.last != "" {
+			log.Printf("Профиль расписания: %s -> %s (покупки: %t, тейк-профит %.3f%%)", s.last, profile.Name, profile.Buy, profile.ProfitPercent)
+		}
+		s.last = profile.Name
+	}
+	return profile
+}
+
+// At - профиль на момент t
+func (s *Schedule) At(t time.Time) Profile {
+	base := Profile{
+		Name:           "default",
+		Buy:            true,
+		ProfitPercent:  s.cfg.ProfitPercent,
+		BaseBuyTimeout: s.cfg.BaseBuyTimeout,
+		SizeMultiplier: 1,
+	}
+	if !s.cfg.Schedule.Enabled {
+		return base
+	}
+
+	t = t.In(s.loc)
+	for _, w := range s.windows {
+		if !w.contains(t) {
+			continue
+		}
+		profile := base
+		profile.Name = w.cfg.Name
+		profile.Buy = !w.cfg.Pause
+		if w.cfg.ProfitPercent > 0 {
+			profile.ProfitPercent = w.cfg.ProfitPercent
+		}
+		if w.cfg.BaseBuyTimeout > 0 {
+			profile.BaseBuyTimeout = w.cfg.BaseBuyTimeout
+		}
+		if w.cfg.SizeMultiplier > 0 {
+			profile.SizeMultiplier = w.cfg.SizeMultiplier
+		}
+		return profile
+	}
+
+	base.Name = outsideName
+	base.Buy = s.cfg.Schedule.OutsideBuy
+	return base
+}
+
+// contains - попадает ли время в окно. Окно через полночь относится ко дню своего начала
+func (w window) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.days[t.Weekday()] && minute >= w.start && minute < w.end
+	}
+	// окно через полночь (или на все сутки при start == end)
+	if minute >= w.start {
+		return w.days[t.Weekday()]
+	}
+	return minute < w.end && w.days[t.AddDate(0, 0, -1).Weekday()]
+}
@@ -0,0 +1,124 @@
+// Package sizing - размер покупки: фиксированное количество монет,
+// фиксированная сумма в USDT или процент от текущего капитала
+package sizing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/schedule"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Режимы размера ордера
+const (
+	ModeBase   = "base"   // order_size монет
+	ModeQuote  = "quote"  // order_size_quote USDT
+	ModeEquity = "equity" // order_size_percent процентов от капитала
+)
+
+// symbolInfoRefresh - как часто обновлять шаг количества и минимальную сумму
+const symbolInfoRefresh = time.Hour
+
+// Sizer - расчёт количества для покупки с учётом шага и минимальной суммы ордера
+type Sizer struct {
+	cfg      config.Config
+	exchange exchange.Exchange
+	schedule *schedule.Schedule
+
+	mu     sync.Mutex
+	info   *exchange.SymbolInfo
+	infoAt time.Time
+}
+
+// NewSizer - конструктор
+func NewSizer(cfg config.Config, ex exchange.Exchange, sched *schedule.Schedule) *Sizer {
+	return &Sizer{cfg: cfg, exchange: ex, schedule: sched}
+}
+
+// Quantity - количество монет для покупки по цене price.
+// accountInfo используется в режиме equity для расчёта капитала. Размер умножается
+// на size_multiplier активного профиля расписания
+func (s *Sizer) Quantity(ctx context.Context, price float64, accountInfo *exchange.AccountInfo) (float64, error) {
+	if price <= 0 {
+		return 0, fmt.Errorf("некорректная цена %.8f", price)
+	}
+	info := s.SymbolInfo(ctx)
+
+	var qty float64
+	switch s.cfg.OrderSizeMode {
+	case ModeQuote:
+		qty = s.cfg.OrderSizeQuote / price
+	case ModeEquity:
+		equity, err := s.equity(accountInfo, info, price)
+		if err != nil {
+			return 0, err
+		}
+		qty = equity * s.cfg.OrderSizePercent / 100 / price
+	default:
+		qty = s.cfg.OrderSize
+	}
+	qty *= s.schedule.Active().SizeMultiplier
+
+	minNotional := exchange.MinNotional
+	step := 0.0
+	if info != nil {
+		minNotional = info.MinNotional()
+		step = info.StepSize()
+		qty = math.Max(qty, info.MinQty())
+	}
+	if step > 0 {
+		qty = math.Floor(qty/step+1e-9) * step
+	}
+	if qty*price < minNotional {
+		qty = minNotional / price
+		if step > 0 {
+			qty = math.Ceil(qty/step-1e-9) * step
+		}
+		log.Printf("Размер покупки увеличен до минимальной суммы ордера %.2f USDT: %.8f", minNotional, qty)
+	}
+	return qty, nil
+}
+
+// equity - капитал в USDT: весь USDT и все монеты по текущей цене
+func (s *Sizer) equity(accountInfo *exchange.AccountInfo, info *exchange.SymbolInfo, price float64) (float64, error) {
+	if accountInfo == nil {
+		return 0, fmt.Errorf("нет информации об аккаунте для расчёта капитала")
+	}
+	base := strings.TrimSuffix(s.cfg.Symbol, "USDT")
+	if info != nil && info.BaseAsset != "" {
+		base = info.BaseAsset
+	}
+	usdt, err := accountInfo.GetTotalBalance("USDT")
+	if err != nil {
+		return 0, err
+	}
+	coins, err := accountInfo.GetTotalBalance(base)
+	if err != nil {
+		return 0, err
+	}
+	return usdt + coins*price, nil
+}
+
+// SymbolInfo - параметры пары с кешем. При ошибке используется предыдущее значение,
+// а без него - количество без округления и минимальная сумма по умолчанию
+func (s *Sizer) SymbolInfo(ctx context.Context) *exchange.SymbolInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.info != nil && time.Since(s.infoAt) < symbolInfoRefresh {
+		return s.info
+	}
+	info, err := s.exchange.GetSymbolInfo(ctx, s.cfg.Symbol)
+	if err != nil {
+		log.Printf("Ошибка получения параметров пары %s: %v", s.cfg.Symbol, err)
+		return s.info
+	}
+	s.info = info
+	s.infoAt = time.Now()
+	return s.info
+}
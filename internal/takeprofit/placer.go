@@ -0,0 +1,366 @@
+package takeprofit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/fees"
+	"scalpingbot/internal/indicator"
+	"scalpingbot/internal/outbox"
+	"scalpingbot/internal/repo"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/schedule"
+	"scalpingbot/internal/tools"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// adaptiveRefresh - как часто пересчитывать процент тейк-профита по ATR
+const adaptiveRefresh = time.Minute
+
+// Placer - размещение тейк-профита для исполненных покупок (лиснер и sell_v1)
+type Placer struct {
+	cfg       config.Config
+	exchange  exchange.Exchange
+	positions repo.PositionRepo
+	orders    repo.OrderStateRepo
+	lots      repository.LotRepository
+	fees      *fees.Tracker // nil - комиссии не учитываются
+	schedule  *schedule.Schedule
+	outbox    *outbox.Outbox
+
+	// sellMu - лиснер и sell_v1 могут одновременно продавать исполнение одной покупки
+	sellMu sync.Mutex
+
+	mu             sync.Mutex
+	adaptivePct    float64
+	adaptiveAt     time.Time
+	lastTargetPct  float64
+	lastVolatility float64
+}
+
+// NewPlacer - конструктор
+func NewPlacer(cfg config.Config, ex exchange.Exchange, positions repo.PositionRepo, orders repo.OrderStateRepo, lots repository.LotRepository,
+	feeTracker *fees.Tracker, sched *schedule.Schedule, ob *outbox.Outbox) *Placer {
+	return &Placer{
+		cfg:       cfg,
+		exchange:  ex,
+		positions: positions,
+		orders:    orders,
+		lots:      lots,
+		fees:      feeTracker,
+		schedule:  sched,
+		outbox:    ob,
+	}
+}
+
+// PlaceSell - размещает ордер на продажу для купленного объёма и запоминает позицию.
+// В режиме трейлинга ордер ставится выше цели как защитный, а продажу по откату делает trailing_v1
+func (p *Placer) PlaceSell(ctx context.Context, buyOrderID string, buyPrice, qty float64) (*exchange.OrderResponse, error) {
+	// Сначала фиксируем исполнение покупки, чтобы при ошибке продажи лот остался видимым
+	if err := p.lots.MarkBuyFilled(ctx, buyOrderID, buyPrice, qty); err != nil {
+		tools.LogErrorf("Ошибка записи покупки %s в журнал: %v", buyOrderID, err)
+	}
+
+	// Цель - чистая прибыль: с комиссиями цена продажи выше на комиссии обеих сторон
+	targetPct := p.TargetPercent(ctx)
+	target := buyPrice * (1 + targetPct/100)
+	if p.fees != nil {
+		p.fees.RecordBuyFee(ctx, buyOrderID)
+		target = p.fees.SellPrice(ctx, buyPrice, targetPct)
+	}
+	price := target
+	if p.cfg.Trailing.Enabled {
+		price = target * (1 + p.cfg.Trailing.ProtectivePercent/100)
+	}
+
+	sellOrder := exchange.SpotOrderRequest{
+		Symbol:   p.cfg.Symbol,
+		Side:     exchange.Sell,
+		Type:     exchange.Limit,
+		Quantity: qty,
+		Price:    price,
+	}
+	intentID, orderResp, err := p.outbox.PlaceSell(ctx, buyOrderID, buyPrice, sellOrder)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Тейк-профит для %s: %.3f%% от цены %.8f", buyOrderID, targetPct, buyPrice)
+	if err := p.lots.SetSellOrder(ctx, buyOrderID, orderResp.OrderID, price); err != nil {
+		tools.LogErrorf("Ошибка записи продажи %s в журнал: %v", orderResp.OrderID, err)
+	}
+	p.outbox.Done(ctx, intentID, orderResp.OrderID)
+
+	p.positions.Add(repo.Position{
+		BuyOrderID:    buyOrderID,
+		SellOrderID:   orderResp.OrderID,
+		EntryPrice:    buyPrice,
+		Qty:           qty,
+		TargetPrice:   target,
+		TargetPercent: targetPct,
+		SellPrice:     price,
+		OpenedAt:      time.Now(),
+		Trailing:      p.cfg.Trailing.Enabled,
+	})
+	return orderResp, nil
+}
+
+// CloseSell - закрывает лоты исполненной продажи, предварительно записав её фактическую комиссию.
+// price 0 (рыночная продажа без суммы исполнения) - цена считается по сделкам ордера.
+// Возвращает repository.ErrLotNotFound, если продажа не из журнала или уже закрыта
+func (p *Placer) CloseSell(ctx context.Context, sellOrderID string, price, qty float64) error {
+	lots, err := p.lots.GetLotsByOrderID(ctx, sellOrderID)
+	if err != nil {
+		return err
+	}
+	open := false
+	for _, lot := range lots {
+		if lot.SellOrderID == sellOrderID && lot.State == repository.LotSellPlaced {
+			open = true
+			break
+		}
+	}
+	if !open {
+		return repository.ErrLotNotFound
+	}
+	if price <= 0 {
+		trades, err := p.exchange.GetOrderTrades(ctx, p.cfg.Symbol, sellOrderID)
+		if err != nil {
+			return fmt.Errorf("ошибка получения цены исполнения продажи: %w", err)
+		}
+		if price = exchange.TradesPrice(trades); price <= 0 {
+			return fmt.Errorf("нет исполнений продажи %s", sellOrderID)
+		}
+	}
+	if p.fees != nil {
+		p.fees.RecordSellFee(ctx, sellOrderID)
+	}
+	if err := p.lots.MarkSellFilled(ctx, sellOrderID, price, qty); err != nil {
+		return err
+	}
+	done := make(map[string]bool)
+	for _, lot := range lots {
+		if !done[lot.BuyOrderID] {
+			done[lot.BuyOrderID] = true
+			p.closeBuy(ctx, lot.BuyOrderID)
+		}
+	}
+	return nil
+}
+
+// SettleCanceled - учитывает исполнение снятой продажи sellOrderID объёмом qty перед выставлением
+// замены (выход по стопу или трейлингу): исполненная часть закрывается в журнале, лоты продажи
+// уменьшаются на неё. Возвращает объём, который осталось продать; 0 - остаток меньше
+// минимальной суммы ордера и лоты продажи закрыты целиком
+func (p *Placer) SettleCanceled(ctx context.Context, sellOrderID string, qty float64) (float64, error) {
+	order, err := p.exchange.GetOrder(ctx, p.cfg.Symbol, sellOrderID, "")
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения снятой продажи %s: %w", sellOrderID, err)
+	}
+	executed, err := strconv.ParseFloat(order.ExecutedQty, 64)
+	if err != nil {
+		return 0, err
+	}
+	if executed <= 0 {
+		return qty, nil
+	}
+
+	price := exchange.FillPrice(order.Price, order.ExecutedQty, order.QuoteQty)
+	remaining := qty - executed
+	if remaining*price < exchange.MinNotional {
+		log.Printf("Продажа %s исполнена на %.8f из %.8f, остаток меньше минимальной суммы", sellOrderID, executed, qty)
+		return 0, p.CloseSell(ctx, sellOrderID, price, executed)
+	}
+	if p.fees != nil {
+		// комиссия снятой продажи - комиссия только исполненной части
+		p.fees.RecordSellFee(ctx, sellOrderID)
+	}
+	if err := p.lots.MarkSellPartFilled(ctx, sellOrderID, price, executed); err != nil {
+		return 0, err
+	}
+	log.Printf("Продажа %s исполнена на %.8f из %.8f, продаётся остаток", sellOrderID, executed, qty)
+	return remaining, nil
+}
+
+// RestoreSell - возвращает снятую продажу oldSellOrderID по прежней цене price на объём qty,
+// когда её замена не разместилась. Лоты журнала и позиция переносятся на возвращённую продажу.
+// Если вернуть не удалось, позиция снимается, а лоты возвращаются в FILLED до сверки при запуске
+func (p *Placer) RestoreSell(ctx context.Context, oldSellOrderID string, qty, price float64) (*exchange.OrderResponse, error) {
+	sellOrder := exchange.SpotOrderRequest{
+		Symbol:   p.cfg.Symbol,
+		Side:     exchange.Sell,
+		Type:     exchange.Limit,
+		Quantity: qty,
+		Price:    price,
+	}
+	intentID, orderResp, err := p.outbox.ReplaceSell(ctx, oldSellOrderID, sellOrder)
+	if err != nil {
+		p.positions.Remove(oldSellOrderID)
+		if err := p.lots.ReopenLot(ctx, oldSellOrderID); err != nil {
+			tools.LogErrorf("Ошибка возврата лотов продажи %s: %v", oldSellOrderID, err)
+		}
+		return nil, err
+	}
+	if err := p.lots.ReplaceSellOrder(ctx, oldSellOrderID, orderResp.OrderID, price); err != nil {
+		tools.LogErrorf("Ошибка переноса лотов продажи %s на %s: %v", oldSellOrderID, orderResp.OrderID, err)
+	} else {
+		p.outbox.Done(ctx, intentID, orderResp.OrderID)
+	}
+	if pos, ok := p.positions.Get(oldSellOrderID); ok {
+		p.positions.Remove(oldSellOrderID)
+		pos.SellOrderID = orderResp.OrderID
+		pos.Qty = qty
+		p.positions.Add(pos)
+	}
+	log.Printf("Продажа %s возвращена по прежней цене %.8f: %s", oldSellOrderID, price, orderResp.OrderID)
+	return orderResp, nil
+}
+
+// closeBuy - переводит покупку в CLOSED, когда все её лоты закрыты
+func (p *Placer) closeBuy(ctx context.Context, buyOrderID string) {
+	lots, err := p.lots.GetLotsByOrderID(ctx, buyOrderID)
+	if err != nil {
+		tools.LogErrorf("Ошибка чтения журнала по покупке %s: %v", buyOrderID, err)
+		return
+	}
+	for _, lot := range lots {
+		if lot.BuyOrderID == buyOrderID && lot.State != repository.LotClosed && lot.State != repository.LotCanceled {
+			return
+		}
+	}
+	p.orders.Transition(buyOrderID, repo.OrderClosed, repo.OrderSellPlaced)
+}
+
+// SellFilled - тейк-профит на полностью исполненную покупку. Продажу размещает только тот
+// (лиснер или sell_v1), кто перевёл покупку в SELL_PLACED; при ошибке она возвращается в FILLED,
+// чтобы sell_v1 повторил. Возвращает nil, если покупку уже продаёт другой компонент
+func (p *Placer) SellFilled(ctx context.Context, buyOrderID string, buyPrice, executedQty float64) (*exchange.OrderResponse, error) {
+	p.orders.Transition(buyOrderID, repo.OrderFilled, repo.OrderNew, repo.OrderPartial)
+	if !p.orders.Transition(buyOrderID, repo.OrderSellPlaced, repo.OrderFilled) {
+		return nil, nil
+	}
+	orderResp, err := p.SellExecuted(ctx, buyOrderID, buyPrice, executedQty)
+	if err != nil {
+		p.orders.Transition(buyOrderID, repo.OrderFilled, repo.OrderSellPlaced)
+		return nil, err
+	}
+	if orderResp == nil {
+		// всё исполнение уже продано частями, покупка могла закрыться раньше
+		p.closeBuy(ctx, buyOrderID)
+	}
+	return orderResp, nil
+}
+
+// CancelPartial - отменяет частично исполненную покупку и продаёт её итоговое исполнение.
+// На время отмены покупка в SELL_PLACED, чтобы лиснер по PartiallyCanceled не начал продажу;
+// объём мог вырасти до отмены, поэтому он перечитывается с биржи. Если продажа не разместилась,
+// покупка остаётся в FILLED и её продаст sell_v1. canceled - ордер снят этим вызовом
+func (p *Placer) CancelPartial(ctx context.Context, buyOrderID string, buyPrice float64) (canceled bool, orderResp *exchange.OrderResponse, err error) {
+	if !p.orders.Transition(buyOrderID, repo.OrderFilled, repo.OrderNew, repo.OrderPartial) ||
+		!p.orders.Transition(buyOrderID, repo.OrderSellPlaced, repo.OrderFilled) {
+		return false, nil, nil
+	}
+	err = p.outbox.CancelOrder(ctx, p.cfg.Symbol, buyOrderID)
+	p.orders.Transition(buyOrderID, repo.OrderFilled, repo.OrderSellPlaced)
+	if err != nil {
+		return false, nil, fmt.Errorf("ошибка отмены покупки %s: %w", buyOrderID, err)
+	}
+
+	order, err := p.exchange.GetOrder(ctx, p.cfg.Symbol, buyOrderID, "")
+	if err != nil {
+		return true, nil, fmt.Errorf("ошибка получения отменённой покупки %s: %w", buyOrderID, err)
+	}
+	qty, err := strconv.ParseFloat(order.ExecutedQty, 64)
+	if err != nil {
+		return true, nil, err
+	}
+	orderResp, err = p.SellFilled(ctx, buyOrderID, buyPrice, qty)
+	return true, orderResp, err
+}
+
+// SellExecuted - размещает тейк-профит на исполненный объём покупки, который ещё не покрыт продажами.
+// Объём исполнения накопительный, поэтому частичные исполнения продаются по мере роста, как только
+// непокрытая часть больше минимальной суммы ордера. Возвращает nil, если продавать нечего
+func (p *Placer) SellExecuted(ctx context.Context, buyOrderID string, buyPrice, executedQty float64) (*exchange.OrderResponse, error) {
+	p.sellMu.Lock()
+	defer p.sellMu.Unlock()
+
+	covered, err := p.lots.CoveredQty(ctx, buyOrderID)
+	if err != nil {
+		return nil, err
+	}
+	qty := executedQty - covered
+	if qty <= 0 {
+		return nil, nil
+	}
+	if qty*buyPrice < exchange.MinNotional {
+		log.Printf("Непокрытый объём покупки %s меньше минимальной суммы: %.8f", buyOrderID, qty)
+		return nil, nil
+	}
+	return p.PlaceSell(ctx, buyOrderID, buyPrice, qty)
+}
+
+// TargetPercent - процент тейк-профита для новой сделки: profit_percent активного профиля расписания
+// или значение от волатильности, если включен adaptive_profit
+func (p *Placer) TargetPercent(ctx context.Context) float64 {
+	pct := p.schedule.Active().ProfitPercent
+	if p.cfg.AdaptiveProfit.Enabled {
+		pct = p.adaptivePercent(ctx)
+	}
+	p.mu.Lock()
+	p.lastTargetPct = pct
+	p.mu.Unlock()
+	return pct
+}
+
+// LastTarget - последний выбранный процент тейк-профита и волатильность (ATR в % от цены)
+func (p *Placer) LastTarget() (float64, float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastTargetPct, p.lastVolatility
+}
+
+// adaptivePercent - ATR в процентах от цены с множителем, в границах min/max.
+// При ошибке получения свечей используется предыдущее значение или profit_percent.
+// Свечи запрашиваются без блокировки, чтобы медленная биржа не задерживала LastTarget
+func (p *Placer) adaptivePercent(ctx context.Context) float64 {
+	cfg := p.cfg.AdaptiveProfit
+	p.mu.Lock()
+	cached, cachedAt := p.adaptivePct, p.adaptiveAt
+	p.mu.Unlock()
+	if cached > 0 && time.Since(cachedAt) < adaptiveRefresh {
+		return cached
+	}
+
+	fallback := cached
+	if fallback == 0 {
+		fallback = math.Min(math.Max(p.cfg.ProfitPercent, cfg.MinPercent), cfg.MaxPercent)
+	}
+
+	klines, err := p.exchange.GetKlines(ctx, p.cfg.Symbol, cfg.Interval, cfg.Period+1)
+	if err != nil {
+		log.Printf("Ошибка получения свечей для ATR, процент тейк-профита %.3f%%: %v", fallback, err)
+		return fallback
+	}
+	atrIndicator := indicator.NewATR(cfg.Period)
+	atr := indicator.Compute(atrIndicator, klines)
+	if !atrIndicator.Ready() {
+		log.Printf("Недостаточно свечей для ATR, процент тейк-профита %.3f%%", fallback)
+		return fallback
+	}
+
+	volatility := atr / klines[len(klines)-1].Close * 100
+	pct := math.Min(math.Max(volatility*cfg.Multiplier, cfg.MinPercent), cfg.MaxPercent)
+	log.Printf("ATR(%d, %s) = %.8f (%.3f%% от цены), процент тейк-профита %.3f%%", cfg.Period, cfg.Interval, atr, volatility, pct)
+
+	p.mu.Lock()
+	p.adaptivePct = pct
+	p.adaptiveAt = time.Now()
+	p.lastVolatility = volatility
+	p.mu.Unlock()
+	return pct
+}
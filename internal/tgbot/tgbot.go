@@ -8,13 +8,20 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"golang.org/x/time/rate"
 	"log"
+	"math"
 	"net/http"
 	"regexp"
+	"scalpingbot/internal/breaker"
 	"scalpingbot/internal/buffer"
 	"scalpingbot/internal/config"
 	"scalpingbot/internal/exchange"
 	"scalpingbot/internal/repo"
 	"scalpingbot/internal/repository"
+	"scalpingbot/internal/rules"
+	"scalpingbot/internal/schedule"
+	"scalpingbot/internal/takeprofit"
+	"scalpingbot/internal/tools"
+	"scalpingbot/internal/worker"
 	"scalpingbot/internal/workers/sell_v1"
 	"strconv"
 	"strings"
@@ -34,6 +41,13 @@ const (
 	stats        = "stats"
 	start        = "start"
 	set_settings = "set_settings"
+	rules_cmd    = "rules"
+	trade        = "trade"
+	resetBreaker = "reset_breaker"
+	workers      = "workers"
+	pauseWorker  = "pause_worker"
+	resumeWorker = "resume_worker"
+	runWorker    = "run_worker"
 )
 
 type TelegramBot struct {
@@ -46,6 +60,12 @@ type TelegramBot struct {
 	cfg           config.Config
 	profitStorage repo.ProfitRepo
 	sqlLiteDb     repository.UserRepository
+	lots          repository.LotRepository
+	placer        *takeprofit.Placer
+	filter        *rules.Filter
+	breaker       *breaker.Breaker
+	schedule      *schedule.Schedule
+	supervisor    *worker.Supervisor
 	limiter       *rate.Limiter
 }
 type BotCommand struct {
@@ -62,7 +82,10 @@ type TelegramUpdate struct {
 	} `json:"message"`
 }
 
-func NewTelegramBot(cfg config.Config, ringBuf buffer.Buffer, storage repo.Repo, ex exchange.Exchange, profitStorage repo.ProfitRepo, sqlLiteDb repository.UserRepository) (*TelegramBot, error) {
+func NewTelegramBot(cfg config.Config, ringBuf buffer.Buffer, storage repo.Repo, ex exchange.Exchange, profitStorage repo.ProfitRepo,
+	sqlLiteDb repository.UserRepository, lots repository.LotRepository, placer *takeprofit.Placer, filter *rules.Filter,
+	circuitBreaker *breaker.Breaker, sched *schedule.Schedule,
+	supervisor *worker.Supervisor) (*TelegramBot, error) {
 	bot, err := tgbotapi.NewBotAPI(cfg.TgToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bot: %w", err)
@@ -78,6 +101,12 @@ func NewTelegramBot(cfg config.Config, ringBuf buffer.Buffer, storage repo.Repo,
 		cfg:           cfg,
 		profitStorage: profitStorage,
 		sqlLiteDb:     sqlLiteDb,
+		lots:          lots,
+		placer:        placer,
+		filter:        filter,
+		breaker:       circuitBreaker,
+		schedule:      sched,
+		supervisor:    supervisor,
 		limiter:       rate.NewLimiter(rate.Every(time.Second), 1), // 1 команда в секунду
 	}
 
@@ -155,7 +184,80 @@ func (tb *TelegramBot) handleCommand(msg *tgbotapi.Message) error {
 			builder.WriteString(fmt.Sprintf("Total Profit last 7d: %.3f USDT\n", profit))
 		}
 
+		// Реализованная прибыль по журналу: чистая после комиссий и валовая
+		for _, period := range []struct {
+			name  string
+			since time.Time
+		}{
+			{"today", tools.StartOfDay(time.Now())},
+			{"7d", time.Now().Add(-7 * 24 * time.Hour)},
+		} {
+			net, err := tb.lots.RealizedProfit(context.Background(), period.since)
+			if err != nil {
+				return err
+			}
+			fees, err := tb.lots.RealizedFees(context.Background(), period.since)
+			if err != nil {
+				return err
+			}
+			builder.WriteString(fmt.Sprintf("Realized %s: net %.4f USDT, gross %.4f USDT, fees %.4f USDT\n",
+				period.name, net, net+fees, fees))
+		}
+
+		if tb.cfg.Deposit > 0 {
+			used, err := tools.CapitalInUse(context.Background(), openOrders, tb.lots, tb.cfg.ProfitPercent)
+			if err != nil {
+				return err
+			}
+			builder.WriteString(fmt.Sprintf("Deposit: used %.2f / %.2f USDT, remaining %.2f USDT\n",
+				used, tb.cfg.Deposit, math.Max(tb.cfg.Deposit-used, 0)))
+		}
+
+		// только чтение: процент от ATR пересчитывается при размещении продаж
+		if tb.cfg.AdaptiveProfit.Enabled {
+			if targetPct, volatility := tb.placer.LastTarget(); targetPct > 0 {
+				builder.WriteString(fmt.Sprintf("Profit target: %.3f%% (ATR %.3f%%)\n", targetPct, volatility))
+			} else {
+				builder.WriteString("Profit target: not calculated yet\n")
+			}
+		} else {
+			builder.WriteString(fmt.Sprintf("Profit target: %.3f%%\n", tb.schedule.Active().ProfitPercent))
+		}
+
+		if tb.cfg.Schedule.Enabled {
+			profile := tb.schedule.Active()
+			builder.WriteString(fmt.Sprintf("Schedule profile: %s (buy: %t, profit %.3f%%, timeout %ds, size x%.2f)\n",
+				profile.Name, profile.Buy, profile.ProfitPercent, profile.BaseBuyTimeout, profile.SizeMultiplier))
+		}
+
+		if tb.breaker != nil {
+			if tripped, reason, until := tb.breaker.State(); tripped {
+				builder.WriteString(fmt.Sprintf("Circuit breaker: tripped until %s (%s)\n", until.Format(time.TimeOnly), reason))
+			} else {
+				builder.WriteString("Circuit breaker: ok\n")
+			}
+		}
+
 		message = builder.String()
+	case resetBreaker:
+		if tb.breaker == nil {
+			message = "Circuit breaker is disabled"
+		} else {
+			tb.breaker.Reset()
+			message = "Circuit breaker reset, buying resumed"
+		}
+	case workers:
+		message = tb.workersMessage()
+	case pauseWorker, resumeWorker, runWorker:
+		message = tb.controlWorker(msg)
+	case rules_cmd:
+		message = tb.rulesMessage()
+	case trade:
+		var err error
+		message, err = tb.tradeMessage(msg)
+		if err != nil {
+			return err
+		}
 	case set_settings:
 		err := tb.handleSetSettings(msg)
 		if err != nil {
@@ -169,6 +271,84 @@ func (tb *TelegramBot) handleCommand(msg *tgbotapi.Message) error {
 	return tb.sendMessage(message)
 }
 
+// tradeMessage - лоты журнала по ордеру на покупку или продажу
+func (tb *TelegramBot) tradeMessage(msg *tgbotapi.Message) (string, error) {
+	orderID := strings.TrimSpace(msg.CommandArguments())
+	if orderID == "" {
+		return "Usage: /trade <orderId>", nil
+	}
+	lots, err := tb.lots.GetLotsByOrderID(context.Background(), orderID)
+	if err != nil {
+		return "", err
+	}
+	if len(lots) == 0 {
+		return fmt.Sprintf("No trades found for order %s", orderID), nil
+	}
+
+	var builder strings.Builder
+	for _, lot := range lots {
+		builder.WriteString(fmt.Sprintf("Lot #%d [%s]\n", lot.ID, lot.State))
+		builder.WriteString(fmt.Sprintf("Buy: %s price=%.8f qty=%.8f fee=%.6f\n", lot.BuyOrderID, lot.BuyPrice, lot.BuyQty, lot.BuyFee))
+		if lot.SellOrderID != "" {
+			builder.WriteString(fmt.Sprintf("Sell: %s price=%.8f qty=%.8f fee=%.6f\n", lot.SellOrderID, lot.SellPrice, lot.SellQty, lot.SellFee))
+		}
+		if lot.State == repository.LotClosed {
+			builder.WriteString(fmt.Sprintf("Profit: %.6f USDT, closed at %s\n", lot.Profit, lot.ClosedAt))
+		}
+		builder.WriteString(fmt.Sprintf("Created: %s, updated: %s\n\n", lot.CreatedAt, lot.UpdatedAt))
+	}
+	return builder.String(), nil
+}
+
+// workersMessage - состояние воркеров супервизора
+func (tb *TelegramBot) workersMessage() string {
+	statuses := tb.supervisor.Statuses()
+	if len(statuses) == 0 {
+		return "No workers running"
+	}
+	var builder strings.Builder
+	for _, status := range statuses {
+		builder.WriteString(status.String() + "\n")
+	}
+	return builder.String()
+}
+
+// controlWorker - пауза, продолжение или внеочередной запуск воркера по имени
+func (tb *TelegramBot) controlWorker(msg *tgbotapi.Message) string {
+	name := strings.TrimSpace(msg.CommandArguments())
+	if name == "" {
+		return fmt.Sprintf("Usage: /%s <worker name>, see /workers", msg.Command())
+	}
+	var err error
+	switch msg.Command() {
+	case pauseWorker:
+		err = tb.supervisor.Pause(name)
+	case resumeWorker:
+		err = tb.supervisor.Resume(name)
+	case runWorker:
+		err = tb.supervisor.Trigger(name)
+	}
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return fmt.Sprintf("Worker %s: %s done", name, msg.Command())
+}
+
+// rulesMessage - текущие значения правил входа
+func (tb *TelegramBot) rulesMessage() string {
+	if tb.filter == nil || tb.filter.Len() == 0 {
+		return "Entry rules are disabled"
+	}
+	pass, results := tb.filter.Evaluate(context.Background())
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("Entry rules (mode: %s), buy allowed: %t\n", tb.cfg.EntryFilter.Mode, pass))
+	for _, r := range results {
+		builder.WriteString(r.String() + "\n")
+	}
+	return builder.String()
+}
+
 // sendMessage отправляет сообщение в чат
 func (tb *TelegramBot) sendMessage(text string) error {
 	msg := tgbotapi.NewMessage(tb.chatID, text)
@@ -186,6 +366,13 @@ func (tb *TelegramBot) registerCommands() error {
 		{Command: stop_worker, Description: "Stop worker"},
 		{Command: logs, Description: "Get last log messages"},
 		{Command: stats, Description: "Get stats"},
+		{Command: trade, Description: "Show position ledger by buy or sell order id: /trade <orderId>"},
+		{Command: rules_cmd, Description: "Show entry rules and current values"},
+		{Command: resetBreaker, Description: "Reset circuit breaker and resume buying"},
+		{Command: workers, Description: "Show workers state, errors and timings"},
+		{Command: pauseWorker, Description: "Pause worker: /pause_worker <name>"},
+		{Command: resumeWorker, Description: "Resume worker: /resume_worker <name>"},
+		{Command: runWorker, Description: "Run worker now: /run_worker <name>"},
 		{Command: set_settings, Description: "Set user settings (profit_percent, order_size, base_buy_timeout, api_key, secret_key, symbol)"},
 	}
 
@@ -3,6 +3,7 @@ package tools
 import (
 	"scalpingbot/internal/exchange"
 	"strconv"
+	"time"
 )
 
 func CalculateSellVolumeInUSDT(orders []exchange.OrderInfo) float64 {
@@ -21,3 +22,8 @@ func CalculateSellVolumeInUSDT(orders []exchange.OrderInfo) float64 {
 
 	return totalSellVolumeUSDT
 }
+
+// StartOfDay - начало суток для t в его часовом поясе
+func StartOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
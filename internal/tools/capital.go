@@ -0,0 +1,50 @@
+package tools
+
+import (
+	"context"
+	"strconv"
+
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/repository"
+)
+
+// CapitalInUse - капитал в работе в USDT: неисполненная часть открытых покупок и непроданные монеты
+// по цене покупки. Монеты берутся из журнала лотов (FILLED и SELL_PLACED), поэтому учитываются и
+// исполненные покупки без продажи, и позиции прошлых запусков. Цена покупки продаж не из журнала
+// (сетка, DCA) восстанавливается из цены продажи
+func CapitalInUse(ctx context.Context, openOrders []exchange.OrderInfo, lots repository.LotRepository, profitPercent float64) (float64, error) {
+	held, err := lots.GetLotsByState(ctx, repository.LotFilled, repository.LotSellPlaced)
+	if err != nil {
+		return 0, err
+	}
+	var total float64
+	ledgerSells := make(map[string]struct{})
+	for _, lot := range held {
+		total += lot.BuyQty * lot.BuyPrice
+		if lot.SellOrderID != "" {
+			ledgerSells[lot.SellOrderID] = struct{}{}
+		}
+	}
+
+	for _, order := range openOrders {
+		price, err1 := strconv.ParseFloat(order.Price, 64)
+		origQty, err2 := strconv.ParseFloat(order.OrigQty, 64)
+		executedQty, err3 := strconv.ParseFloat(order.ExecutedQty, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+
+		remaining := origQty - executedQty
+		switch order.Side {
+		case exchange.Buy:
+			// исполненная часть уже в журнале, остаток - зарезервированные USDT
+			total += remaining * price
+		case exchange.Sell:
+			if _, ok := ledgerSells[order.OrderID]; !ok {
+				total += remaining * price / (1 + profitPercent/100)
+			}
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,18 @@
+package tools
+
+import (
+	"context"
+	"time"
+)
+
+// Sleep - пауза, которая прерывается отменой контекста. Возвращает ctx.Err() при отмене
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -5,8 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"scalpingbot/internal/logger"
 	"scalpingbot/internal/tools"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,43 +19,307 @@ type Worker interface {
 	Name() string
 }
 
-func Start(ctx context.Context, w Worker, period time.Duration, logLogger logger.Logger) error {
-	log.Printf("Воркер %s запущен", w.Name())
+// maxBackoff - максимальная пауза после серии ошибок
+const maxBackoff = 10 * time.Minute
+
+// alertFailures - после скольких ошибок подряд сообщать в Telegram
+const alertFailures = 5
+
+// ErrUnknownWorker - воркер с таким именем не запущен
+var ErrUnknownWorker = errors.New("воркер не найден")
+
+// State - состояние воркера в супервизоре
+type State string
+
+const (
+	StateRunning State = "running" // выполняется Process
+	StateIdle    State = "idle"    // ждёт следующего запуска
+	StateBackoff State = "backoff" // ждёт после ошибки
+	StatePaused  State = "paused"  // остановлен вручную
+	StateStopped State = "stopped" // контекст отменён
+)
+
+// Status - состояние и статистика воркера
+type Status struct {
+	Name         string
+	State        State
+	Period       time.Duration
+	Runs         int
+	Failures     int // ошибок подряд
+	LastRun      time.Time
+	LastSuccess  time.Time
+	LastError    string
+	LastErrorAt  time.Time
+	LastDuration time.Duration
+	AvgDuration  time.Duration
+	NextRun      time.Time
+}
+
+// String - строка для Telegram
+func (s Status) String() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("%s [%s] every %s, runs %d", s.Name, s.State, s.Period, s.Runs))
+	if !s.LastSuccess.IsZero() {
+		builder.WriteString(fmt.Sprintf(", ok %s ago", time.Since(s.LastSuccess).Round(time.Second)))
+	}
+	builder.WriteString(fmt.Sprintf(", last %s, avg %s", s.LastDuration.Round(time.Millisecond), s.AvgDuration.Round(time.Millisecond)))
+	if s.Failures > 0 {
+		builder.WriteString(fmt.Sprintf(", failures %d", s.Failures))
+	}
+	if s.LastError != "" {
+		builder.WriteString(fmt.Sprintf("\n  error %s ago: %s", time.Since(s.LastErrorAt).Round(time.Second), s.LastError))
+	}
+	if s.State == StateIdle || s.State == StateBackoff {
+		builder.WriteString(fmt.Sprintf("\n  next in %s", time.Until(s.NextRun).Round(time.Second)))
+	}
+	return builder.String()
+}
+
+// Supervisor - запуск воркеров с учётом состояния, экспоненциальной паузой после ошибок
+// и ручным управлением: пауза, продолжение, внеочередной запуск
+type Supervisor struct {
+	logger logger.Logger
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	wg      sync.WaitGroup
+}
+
+type entry struct {
+	worker Worker
+	wake   chan struct{} // Resume и Trigger будят цикл воркера
+
+	mu        sync.Mutex
+	status    Status
+	paused    bool
+	triggered bool
+	total     time.Duration // суммарное время выполнения для среднего
+}
+
+// NewSupervisor - конструктор
+func NewSupervisor(logLogger logger.Logger) *Supervisor {
+	return &Supervisor{logger: logLogger, entries: make(map[string]*entry)}
+}
+
+// Start - запускает воркер с периодом period
+func (s *Supervisor) Start(ctx context.Context, w Worker, period time.Duration) error {
 	if period == 0 {
 		return errors.New("schedule period = 0")
 	}
+	s.mu.Lock()
+	if _, ok := s.entries[w.Name()]; ok {
+		s.mu.Unlock()
+		return fmt.Errorf("воркер %s уже запущен", w.Name())
+	}
+	e := &entry{
+		worker: w,
+		wake:   make(chan struct{}, 1),
+		status: Status{Name: w.Name(), State: StateIdle, Period: period},
+	}
+	s.entries[w.Name()] = e
+	s.mu.Unlock()
+
+	log.Printf("Воркер %s запущен", w.Name())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run(ctx, e)
+	}()
+	return nil
+}
 
-	go runWorkerPeriodically(ctx, w, period, logLogger)
+// Pause - останавливает запуски воркера. Текущий запуск доработает до конца
+func (s *Supervisor) Pause(name string) error {
+	e, err := s.entry(name)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.paused = true
+	e.mu.Unlock()
+	log.Printf("Воркер %s поставлен на паузу", name)
+	return nil
+}
 
+// Resume - снимает паузу и сбрасывает ожидание после ошибок
+func (s *Supervisor) Resume(name string) error {
+	e, err := s.entry(name)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.paused = false
+	e.mu.Unlock()
+	e.notify()
+	log.Printf("Воркер %s продолжает работу", name)
 	return nil
 }
 
-// runWorkerPeriodically запускает воркер с периодом
-func runWorkerPeriodically(ctx context.Context, w Worker, period time.Duration, logLogger logger.Logger) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Print(ctx, "Worker-Panic", fmt.Errorf("%v", r), "worker name ", w.Name())
-			go runWorkerPeriodically(ctx, w, period, logLogger)
-		}
-	}()
+// Trigger - внеочередной запуск воркера, в том числе на паузе
+func (s *Supervisor) Trigger(name string) error {
+	e, err := s.entry(name)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.triggered = true
+	e.mu.Unlock()
+	e.notify()
+	log.Printf("Внеочередной запуск воркера %s", name)
+	return nil
+}
+
+// Status - состояние воркера
+func (s *Supervisor) Status(name string) (Status, error) {
+	e, err := s.entry(name)
+	if err != nil {
+		return Status{}, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status, nil
+}
+
+// Statuses - состояния всех воркеров по имени
+func (s *Supervisor) Statuses() []Status {
+	s.mu.Lock()
+	entries := make([]*entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(entries))
+	for _, e := range entries {
+		e.mu.Lock()
+		statuses = append(statuses, e.status)
+		e.mu.Unlock()
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
 
+// Wait - ожидание остановки всех воркеров после отмены контекста.
+// Текущие запуски Process дорабатывают до конца
+func (s *Supervisor) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Supervisor) entry(name string) (*entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownWorker, name)
+	}
+	return e, nil
+}
+
+// run - цикл воркера: запуск, пауза на период или backoff, ожидание на паузе
+func (s *Supervisor) run(ctx context.Context, e *entry) {
+	defer e.setState(StateStopped)
 	for {
-		var err error
+		e.mu.Lock()
+		wait := e.paused && !e.triggered
+		e.triggered = false
+		if wait {
+			e.status.State = StatePaused
+		}
+		e.mu.Unlock()
+
+		if wait {
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.wake:
+				continue
+			}
+		}
 
+		if ctx.Err() != nil {
+			return
+		}
+		delay := s.runOnce(ctx, e)
+
+		timer := time.NewTimer(delay)
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			return
-		default:
-			err = w.Process(ctx)
+		case <-timer.C:
+		case <-e.wake:
+			timer.Stop()
 		}
+	}
+}
+
+// runOnce - один запуск с перехватом паники. Возвращает паузу до следующего запуска
+func (s *Supervisor) runOnce(ctx context.Context, e *entry) time.Duration {
+	name := e.worker.Name()
+	started := time.Now()
+	e.setState(StateRunning)
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return e.worker.Process(ctx)
+	}()
+	duration := time.Since(started)
+	if err != nil && ctx.Err() != nil {
+		// запуск прерван остановкой бота, это не ошибка воркера
+		log.Printf("Воркер %s остановлен: %v", name, err)
+		return 0
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status.Runs++
+	e.status.LastRun = started
+	e.status.LastDuration = duration
+	e.total += duration
+	e.status.AvgDuration = e.total / time.Duration(e.status.Runs)
+
+	delay := e.status.Period
+	if err != nil {
+		e.status.Failures++
+		e.status.LastError = err.Error()
+		e.status.LastErrorAt = time.Now()
+		e.status.State = StateBackoff
+		// период, удваивается с каждой ошибкой подряд
+		backoff := float64(e.status.Period) * math.Pow(2, float64(e.status.Failures-1))
+		delay = time.Duration(math.Min(backoff, float64(max(maxBackoff, e.status.Period))))
 
-		if err != nil {
-			tools.LogErrorf("Worker-Error name: %s, err: %v", err, w.Name())
-			logLogger.Error(fmt.Sprintf("Worker-Error name: %s, err: %v", err, w.Name()))
-			time.Sleep(period)
-		} else {
-			log.Print("Worker job success", "worker name ", w.Name())
-			time.Sleep(period)
+		tools.LogErrorf("Worker-Error name: %s, err: %v", name, err)
+		s.logger.Error(fmt.Sprintf("Worker-Error name: %s, err: %v, failures: %d, retry in %s", name, err, e.status.Failures, delay))
+		if e.status.Failures == alertFailures {
+			s.logger.Notify(fmt.Sprintf("Воркер %s: %d ошибок подряд, последняя: %v", name, e.status.Failures, err))
 		}
+	} else {
+		if e.status.Failures >= alertFailures {
+			s.logger.Notify(fmt.Sprintf("Воркер %s восстановился после %d ошибок", name, e.status.Failures))
+		}
+		e.status.Failures = 0
+		e.status.LastSuccess = time.Now()
+		e.status.State = StateIdle
+		log.Print("Worker job success", "worker name ", name)
+	}
+	e.status.NextRun = time.Now().Add(delay)
+	return delay
+}
+
+func (e *entry) setState(state State) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status.State = state
+}
+
+// notify - будит цикл воркера, не блокируясь, если он уже разбужен
+func (e *entry) notify() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
 	}
 }
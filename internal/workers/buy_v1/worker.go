@@ -2,32 +2,66 @@ package buy_v1
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"scalpingbot/internal/config"
 	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/outbox"
 	"scalpingbot/internal/repo"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/rules"
+	"scalpingbot/internal/schedule"
+	"scalpingbot/internal/sizing"
 	"scalpingbot/internal/tgbot"
 	"scalpingbot/internal/tools"
 	"scalpingbot/internal/workers/sell_v1"
 	"time"
 )
 
+// localHighWindow - за сколько минутных свечей ищем локальный максимум для drop_percent
+const localHighWindow = 60
+
 // WorkerFunc — тип для воркера
 type WorkerFunc func(ctx context.Context) error
 
 // Bot - структура бота
 type Bot struct {
-	config   config.Config
-	exchange exchange.Exchange
-	storage  repo.Repo
+	config    config.Config
+	exchange  exchange.Exchange
+	storage   repo.Repo
+	orders    repo.OrderStateRepo
+	lots      repository.LotRepository
+	filter    *rules.Filter // правила входа, nil - покупаем без фильтра
+	sizer     *sizing.Sizer
+	schedule  *schedule.Schedule
+	outbox    *outbox.Outbox
+	lastBuyAt time.Time
+	chase     *makerBuy // последняя maker покупка, которую ведём за bid
+}
+
+// makerBuy - выставленная maker покупка
+type makerBuy struct {
+	orderID    string
+	price      float64
+	startPrice float64 // первая цена, от неё считается max_chase_percent
+	qty        float64
 }
 
 // NewBot - конструктор бота
-func NewBot(cfg config.Config, ex exchange.Exchange, storage repo.Repo) *Bot {
+func NewBot(cfg config.Config, ex exchange.Exchange, storage repo.Repo, orders repo.OrderStateRepo,
+	lots repository.LotRepository, filter *rules.Filter, sizer *sizing.Sizer, sched *schedule.Schedule, ob *outbox.Outbox) *Bot {
 	return &Bot{
 		config:   cfg,
 		exchange: ex,
 		storage:  storage,
+		orders:   orders,
+		lots:     lots,
+		filter:   filter,
+		sizer:    sizer,
+		schedule: sched,
+		outbox:   ob,
 	}
 }
 
@@ -38,6 +72,17 @@ func (b *Bot) Process(ctx context.Context) error {
 		return nil
 	}
 
+	// Пока maker покупка стоит, переставляем её за bid и новых не ставим
+	if b.chase != nil {
+		return b.chaseBuy(ctx)
+	}
+
+	// Покупки запрещены расписанием
+	if profile := b.schedule.Active(); !profile.Buy {
+		log.Printf("Покупки выключены расписанием (профиль %s), ожидание...", profile.Name)
+		return tools.Sleep(ctx, time.Minute)
+	}
+
 	// чекаем тренд и ждем
 	err := b.SleepTimeout(ctx)
 	if err != nil {
@@ -70,28 +115,225 @@ func (b *Bot) Process(ctx context.Context) error {
 	}
 	log.Printf("Текущая цена KAS/USDT: %.6f\n", price)
 	log.Printf("Баланс usdt: %v", usdtBalance)
+	qty, err := b.sizer.Quantity(ctx, price, accountInfo)
+	if err != nil {
+		return err
+	}
 
-	if usdtBalance > (b.config.OrderSize * price) {
+	if usdtBalance > (qty * price) {
+		// Пауза между покупками
+		if delay := time.Duration(b.config.DelaySeconds) * time.Second; time.Since(b.lastBuyAt) < delay {
+			log.Printf("С последней покупки прошло меньше %s, ожидание...", delay)
+			return nil
+		}
+		// Лимит капитала в работе
+		if b.config.Deposit > 0 {
+			used, err := tools.CapitalInUse(ctx, openOrders, b.lots, b.config.ProfitPercent)
+			if err != nil {
+				return err
+			}
+			if used+qty*price > b.config.Deposit {
+				log.Printf("Превышен депозит: в работе %.2f из %.2f USDT, ожидание...", used, b.config.Deposit)
+				return nil
+			}
+		}
+		ok, err := b.checkDrop(ctx, price)
+		if err != nil {
+			return err
+		}
+		if !ok || !b.checkEntryRules(ctx) {
+			return nil
+		}
 		order := exchange.SpotOrderRequest{
 			Symbol:   b.config.Symbol,
 			Side:     exchange.Buy,
 			Type:     exchange.Limit,
-			Quantity: b.config.OrderSize,
+			Quantity: qty,
 			Price:    price,
 		}
-		orderResp, err := b.exchange.PlaceOrder(ctx, order)
+		if b.config.MakerBuy.Enabled {
+			order.Type = exchange.LimitMaker
+			order.Price, err = b.makerPrice(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		// если процесс упадёт до записи в журнал, покупку запишет Replayer при запуске
+		intentID, orderResp, err := b.outbox.PlaceBuy(ctx, order)
+		if errors.Is(err, exchange.ErrBlocked) {
+			// причина уже залогирована риск-менеджером
+			return nil
+		}
 		if err != nil {
 			return err
 		}
-		b.storage.Add(orderResp.OrderID)
+		b.orders.Track(orderResp.OrderID)
+		b.lastBuyAt = time.Now()
+		_, err = b.lots.CreateLot(ctx, repository.Lot{
+			Symbol:     b.config.Symbol,
+			BuyOrderID: orderResp.OrderID,
+			BuyPrice:   order.Price,
+			BuyQty:     qty,
+		})
+		if err != nil {
+			tools.LogErrorf("Ошибка записи покупки %s в журнал: %v", orderResp.OrderID, err)
+		} else {
+			b.outbox.Done(ctx, intentID, orderResp.OrderID)
+		}
+		if order.Type == exchange.LimitMaker {
+			b.chase = &makerBuy{orderID: orderResp.OrderID, price: order.Price, startPrice: order.Price, qty: qty}
+		}
 		log.Printf("Ордер на покупку размещен: %s Price=%s", orderResp.OrderID, orderResp.Price)
 	} else {
 		log.Printf("Баланс usdt меньше заданного размера ордера, ожидание...")
-		time.Sleep(time.Second * 15)
+		return tools.Sleep(ctx, time.Second*15)
 	}
 	return nil
 }
 
+// makerPrice - цена maker покупки: лучший bid минус offset_ticks шагов цены
+func (b *Bot) makerPrice(ctx context.Context) (float64, error) {
+	book, err := b.exchange.GetBookTicker(ctx, b.config.Symbol)
+	if err != nil {
+		return 0, err
+	}
+	bid, err := book.Bid()
+	if err != nil {
+		return 0, err
+	}
+	tick, err := b.tickSize(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return bid - float64(b.config.MakerBuy.OffsetTicks)*tick, nil
+}
+
+func (b *Bot) tickSize(ctx context.Context) (float64, error) {
+	info := b.sizer.SymbolInfo(ctx)
+	if info == nil {
+		return 0, fmt.Errorf("нет шага цены для %s", b.config.Symbol)
+	}
+	return info.TickSize(), nil
+}
+
+// chaseBuy - переставляет maker покупку, когда bid ушёл выше неё больше чем на chase_ticks,
+// но не дальше max_chase_percent от первой цены. Отмена старой покупки обрабатывается
+// лиснером (состояния покупок и журнал), в том числе если она успела частично исполниться
+func (b *Bot) chaseBuy(ctx context.Context) error {
+	openOrders, err := b.exchange.GetOpenOrders(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+	var current *exchange.OrderInfo
+	for i := range openOrders {
+		if openOrders[i].OrderID == b.chase.orderID {
+			current = &openOrders[i]
+			break
+		}
+	}
+	// Исполнена, отменена или начала исполняться - дальше её ведут лиснер и sell_v1
+	if current == nil || current.Status != exchange.New {
+		b.chase = nil
+		return nil
+	}
+
+	book, err := b.exchange.GetBookTicker(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+	bid, err := book.Bid()
+	if err != nil {
+		return err
+	}
+	tick, err := b.tickSize(ctx)
+	if err != nil {
+		return err
+	}
+	if bid-b.chase.price <= float64(b.config.MakerBuy.ChaseTicks)*tick {
+		return nil
+	}
+	newPrice := bid - float64(b.config.MakerBuy.OffsetTicks)*tick
+	if newPrice > b.chase.startPrice*(1+b.config.MakerBuy.MaxChasePercent/100) {
+		log.Printf("Покупка %s: bid %.8f дальше max_chase_percent от %.8f, больше не переставляем", b.chase.orderID, bid, b.chase.startPrice)
+		b.chase = nil
+		return nil
+	}
+
+	if err := b.outbox.CancelOrder(ctx, b.config.Symbol, b.chase.orderID); err != nil {
+		log.Printf("Ошибка отмены покупки %s для перестановки: %v", b.chase.orderID, err)
+		b.chase = nil
+		return nil
+	}
+	order := exchange.SpotOrderRequest{
+		Symbol:   b.config.Symbol,
+		Side:     exchange.Buy,
+		Type:     exchange.LimitMaker,
+		Quantity: b.chase.qty,
+		Price:    newPrice,
+	}
+	intentID, orderResp, err := b.outbox.PlaceBuy(ctx, order)
+	if err != nil {
+		b.chase = nil
+		if errors.Is(err, exchange.ErrBlocked) {
+			return nil
+		}
+		return err
+	}
+	b.orders.Track(orderResp.OrderID)
+	_, err = b.lots.CreateLot(ctx, repository.Lot{
+		Symbol:     b.config.Symbol,
+		BuyOrderID: orderResp.OrderID,
+		BuyPrice:   newPrice,
+		BuyQty:     b.chase.qty,
+	})
+	if err != nil {
+		tools.LogErrorf("Ошибка записи покупки %s в журнал: %v", orderResp.OrderID, err)
+	} else {
+		b.outbox.Done(ctx, intentID, orderResp.OrderID)
+	}
+	log.Printf("Покупка переставлена за bid: %s -> %s цена %.8f -> %s", b.chase.orderID, orderResp.OrderID, b.chase.price, orderResp.Price)
+	b.chase.orderID = orderResp.OrderID
+	b.chase.price = newPrice
+	return nil
+}
+
+// checkDrop - покупаем только после падения цены на drop_percent от локального максимума
+func (b *Bot) checkDrop(ctx context.Context, price float64) (bool, error) {
+	if b.config.DropPercent <= 0 {
+		return true, nil
+	}
+	klines, err := b.exchange.GetKlines(ctx, b.config.Symbol, exchange.KlineInterval1m, localHighWindow)
+	if err != nil {
+		return false, err
+	}
+	var high float64
+	for _, k := range klines {
+		high = math.Max(high, k.High)
+	}
+	trigger := high * (1 - b.config.DropPercent/100)
+	if price > trigger {
+		log.Printf("Цена %.6f не упала на %.2f%% от локального максимума %.6f (нужно <= %.6f), ожидание...", price, b.config.DropPercent, high, trigger)
+		return false, nil
+	}
+	return true, nil
+}
+
+// checkEntryRules - проверка правил входа, по каждому правилу пишем почему покупка пропущена
+func (b *Bot) checkEntryRules(ctx context.Context) bool {
+	if b.filter == nil {
+		return true
+	}
+	pass, results := b.filter.Evaluate(ctx)
+	if pass {
+		return true
+	}
+	log.Printf("Покупка пропущена правилами входа:")
+	for _, r := range results {
+		log.Printf("  %s", r)
+	}
+	return false
+}
+
 func (b *Bot) SleepTimeout(ctx context.Context) error {
 	// получаем klines
 	klines, err := b.exchange.GetKlines(ctx, b.config.Symbol, exchange.KlineInterval1m, 10)
@@ -99,10 +341,9 @@ func (b *Bot) SleepTimeout(ctx context.Context) error {
 		return err
 	}
 
-	timeout := tools.AdjustTimeout(b.config.BaseBuyTimeout, klines)
+	timeout := tools.AdjustTimeout(b.schedule.Active().BaseBuyTimeout, klines)
 	log.Printf("Спим таймаут: %d", timeout)
-	time.Sleep(time.Second * time.Duration(timeout))
-	return nil
+	return tools.Sleep(ctx, time.Second*time.Duration(timeout))
 }
 
 func (b *Bot) Name() string {
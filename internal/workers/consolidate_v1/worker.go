@@ -0,0 +1,233 @@
+package consolidate_v1
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/logger"
+	"scalpingbot/internal/outbox"
+	"scalpingbot/internal/repo"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/takeprofit"
+	"scalpingbot/internal/workers/sell_v1"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// sellOrder - открытая продажа, которую можно объединить
+type sellOrder struct {
+	orderID string
+	price   float64
+	qty     float64
+}
+
+// Bot - объединяет соседние по цене продажи в один ордер, когда открытых ордеров
+// становится близко к лимиту биржи и buy_v1 перестаёт покупать
+type Bot struct {
+	config    config.Config
+	exchange  exchange.Exchange
+	positions repo.PositionRepo
+	lots      repository.LotRepository
+	outbox    *outbox.Outbox
+	placer    *takeprofit.Placer
+	logger    logger.Logger
+}
+
+// NewBot - конструктор бота
+func NewBot(cfg config.Config, ex exchange.Exchange, positions repo.PositionRepo, lots repository.LotRepository,
+	ob *outbox.Outbox, placer *takeprofit.Placer, logLogger logger.Logger) *Bot {
+	return &Bot{
+		config:    cfg,
+		exchange:  ex,
+		positions: positions,
+		lots:      lots,
+		outbox:    ob,
+		placer:    placer,
+		logger:    logLogger,
+	}
+}
+
+func (b *Bot) Process(ctx context.Context) error {
+	openOrders, err := b.exchange.GetOpenOrders(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+	buyCount, sellCount := sell_v1.GetCountOpenOrders(openOrders)
+	excess := buyCount + sellCount - b.config.Consolidate.Threshold + 1
+	if excess <= 0 {
+		return nil
+	}
+
+	// Объединяются только продажи бота из журнала: ручные продажи и ордера сетки не трогаем
+	lots, err := b.lots.GetLotsByState(ctx, repository.LotSellPlaced)
+	if err != nil {
+		return err
+	}
+	placed := make(map[string]struct{}, len(lots))
+	for _, lot := range lots {
+		placed[lot.SellOrderID] = struct{}{}
+	}
+
+	var sells []sellOrder
+	for _, order := range openOrders {
+		if order.Side != exchange.Sell || order.Status != exchange.New {
+			continue
+		}
+		if _, ok := placed[order.OrderID]; !ok {
+			continue
+		}
+		// Защитные ордера трейлинга не трогаем: их ведёт trailing_v1
+		if p, ok := b.positions.Get(order.OrderID); ok && p.Trailing {
+			continue
+		}
+		price, err1 := strconv.ParseFloat(order.Price, 64)
+		qty, err2 := strconv.ParseFloat(order.OrigQty, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		sells = append(sells, sellOrder{orderID: order.OrderID, price: price, qty: qty})
+	}
+	sort.Slice(sells, func(i, j int) bool { return sells[i].price < sells[j].price })
+
+	groups := b.groups(sells, excess)
+	if len(groups) == 0 {
+		log.Printf("Открытых ордеров %d, но соседних продаж для объединения нет", buyCount+sellCount)
+		return nil
+	}
+	log.Printf("Открытых ордеров %d, объединяем групп продаж: %d", buyCount+sellCount, len(groups))
+
+	for _, group := range groups {
+		if err := b.merge(ctx, group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groups - группы подряд идущих по цене продаж с разбросом не больше max_spread_percent.
+// Набирает группы, пока не освободится excess ордеров
+func (b *Bot) groups(sells []sellOrder, excess int) [][]sellOrder {
+	var result [][]sellOrder
+	for i := 0; i < len(sells) && excess > 0; {
+		j := i + 1
+		maxPrice := sells[i].price * (1 + b.config.Consolidate.MaxSpreadPercent/100)
+		for j < len(sells) && j-i < b.config.Consolidate.GroupSize && sells[j].price <= maxPrice {
+			j++
+		}
+		if j-i < 2 {
+			i++
+			continue
+		}
+		result = append(result, sells[i:j])
+		excess -= j - i - 1
+		i = j
+	}
+	return result
+}
+
+// merge - отменяет продажи группы и выставляет одну на суммарный неисполненный объём по
+// средневзвешенной цене. Лоты журнала и позиции переносятся на новый ордер. Если объединённая
+// продажа не разместилась, снятые продажи возвращаются по прежним ценам
+func (b *Bot) merge(ctx context.Context, group []sellOrder) error {
+	var canceled []sellOrder
+	for _, s := range group {
+		if err := b.outbox.CancelOrder(ctx, b.config.Symbol, s.orderID); err != nil {
+			// скорее всего продажа уже исполнена
+			log.Printf("Ошибка отмены продажи %s при объединении: %v", s.orderID, err)
+			continue
+		}
+		// продажа могла исполниться частично после получения списка открытых: объединяем только остаток
+		remaining, err := b.placer.SettleCanceled(ctx, s.orderID, s.qty)
+		if err != nil {
+			log.Printf("Ошибка учёта снятой продажи %s при объединении: %v", s.orderID, err)
+			b.restore(ctx, []sellOrder{s})
+			continue
+		}
+		if remaining == 0 {
+			continue
+		}
+		s.qty = remaining
+		canceled = append(canceled, s)
+	}
+	if len(canceled) < 2 {
+		// объединять нечего
+		b.restore(ctx, canceled)
+		return nil
+	}
+
+	var qty, amount float64
+	for _, s := range canceled {
+		qty += s.qty
+		amount += s.qty * s.price
+	}
+
+	price := amount / qty
+	if step := b.config.Consolidate.PriceStep; step > 0 {
+		price = math.Ceil(price/step-1e-9) * step
+	}
+	sellOrder := exchange.SpotOrderRequest{
+		Symbol:   b.config.Symbol,
+		Side:     exchange.Sell,
+		Type:     exchange.Limit,
+		Quantity: qty,
+		Price:    price,
+	}
+	canceledIDs := make([]string, len(canceled))
+	for i, s := range canceled {
+		canceledIDs[i] = s.orderID
+	}
+	// если ответ не дошёл, при запуске Replayer перенесёт лоты на продажу или вернёт их в FILLED
+	intentIDs, orderResp, err := b.outbox.ReplaceSells(ctx, canceledIDs, sellOrder)
+	if err != nil {
+		b.logger.Error(fmt.Sprintf("Ошибка размещения объединённой продажи %.8f по %.8f, отменено продаж: %d: %v", qty, price, len(canceled), err))
+		b.restore(ctx, canceled)
+		return err
+	}
+
+	merged := repo.Position{SellOrderID: orderResp.OrderID, Qty: qty, TargetPrice: price, SellPrice: price, OpenedAt: time.Now()}
+	var entryAmount float64
+	for i, s := range canceled {
+		if err := b.lots.ReplaceSellOrder(ctx, s.orderID, orderResp.OrderID, price); err != nil {
+			log.Printf("Ошибка переноса лотов продажи %s на %s: %v", s.orderID, orderResp.OrderID, err)
+		} else {
+			b.outbox.Done(ctx, intentIDs[i], orderResp.OrderID)
+		}
+		p, ok := b.positions.Get(s.orderID)
+		if !ok {
+			p = repo.Position{EntryPrice: s.price / (1 + b.config.ProfitPercent/100), OpenedAt: time.Now()}
+		}
+		b.positions.Remove(s.orderID)
+		entryAmount += p.EntryPrice * s.qty
+		if merged.BuyOrderID == "" {
+			merged.BuyOrderID = p.BuyOrderID
+		}
+		if p.OpenedAt.Before(merged.OpenedAt) {
+			merged.OpenedAt = p.OpenedAt
+		}
+	}
+	merged.EntryPrice = entryAmount / qty
+	if merged.EntryPrice > 0 {
+		merged.TargetPercent = (price/merged.EntryPrice - 1) * 100
+	}
+	b.positions.Add(merged)
+
+	log.Printf("Объединено продаж: %d в %s, объём=%.8f цена=%s", len(canceled), orderResp.OrderID, qty, orderResp.Price)
+	return nil
+}
+
+// restore - возвращает снятые продажи по прежним ценам на их неисполненный объём
+func (b *Bot) restore(ctx context.Context, sells []sellOrder) {
+	for _, s := range sells {
+		if _, err := b.placer.RestoreSell(ctx, s.orderID, s.qty, s.price); err != nil {
+			b.logger.Error(fmt.Sprintf("Ошибка возврата продажи %s по %.8f, монеты %.8f остались без продажи: %v", s.orderID, s.price, s.qty, err))
+		}
+	}
+}
+
+func (b *Bot) Name() string {
+	return "consolidate_v1"
+}
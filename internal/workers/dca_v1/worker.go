@@ -0,0 +1,630 @@
+package dca_v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"scalpingbot/internal/breaker"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/logger"
+	"scalpingbot/internal/outbox"
+	"scalpingbot/internal/repo"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/tgbot"
+	"scalpingbot/internal/workers/sell_v1"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// baseOrderTimeout - через сколько отменять неисполненную первую покупку
+const baseOrderTimeout = 10 * time.Minute
+
+// Bot - стратегия усреднения: первая покупка, страховочные ордера на просадках
+// и один тейк-профит на всю позицию от средней цены. Сделка хранится в базе,
+// чтобы после перезапуска продолжить её, а не открыть новую рядом
+type Bot struct {
+	config   config.Config
+	exchange exchange.Exchange
+	storage  repo.Repo
+	dealRepo repository.DCARepository
+	outbox   *outbox.Outbox
+	logger   logger.Logger
+	breaker  *breaker.Breaker
+
+	// mu держится на время запросов к бирже, поэтому исполнения из лиснера
+	// ставятся в очередь fills и обрабатываются отдельной горутиной
+	mu     sync.Mutex
+	loaded bool
+	deal   *repository.DCADeal
+
+	fills chan exchange.OrderUpdate
+	wg    sync.WaitGroup
+}
+
+// fillsBuffer - размер очереди исполнений. Исполнения сверх неё найдёт воркер
+const fillsBuffer = 100
+
+// NewBot - конструктор бота
+func NewBot(cfg config.Config, ex exchange.Exchange, storage repo.Repo, dealRepo repository.DCARepository,
+	ob *outbox.Outbox, logLogger logger.Logger, circuitBreaker *breaker.Breaker) *Bot {
+	return &Bot{
+		config:   cfg,
+		exchange: ex,
+		storage:  storage,
+		dealRepo: dealRepo,
+		outbox:   ob,
+		logger:   logLogger,
+		breaker:  circuitBreaker,
+		fills:    make(chan exchange.OrderUpdate, fillsBuffer),
+	}
+}
+
+func (b *Bot) Process(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.loaded {
+		if err := b.load(ctx); err != nil {
+			return err
+		}
+	}
+	defer b.save(ctx)
+
+	if b.deal == nil {
+		// заглушка для переключения статуса бота: новые сделки не открываем, текущую ведём
+		if !b.storage.Has(tgbot.WorkerStatusKey) {
+			log.Printf("Воркер %s в тг спящем режиме", b.Name())
+			return nil
+		}
+		return b.openDeal(ctx)
+	}
+
+	openOrders, err := b.exchange.GetOpenOrders(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+	if err := b.syncFills(ctx, openOrders); err != nil {
+		return err
+	}
+	if b.deal == nil {
+		return nil
+	}
+	// Частичные исполнения покупок, которые лиснер пропустил
+	for _, order := range openOrders {
+		if order.Side != exchange.Buy || !b.ownsOrder(order.OrderID) {
+			continue
+		}
+		price, err1 := strconv.ParseFloat(order.Price, 64)
+		executed, err2 := strconv.ParseFloat(order.ExecutedQty, 64)
+		if err1 == nil && err2 == nil && executed > b.executed(order.OrderID) {
+			b.onFilled(ctx, order.OrderID, price, executed, false)
+		}
+	}
+
+	// Первая покупка так и не исполнилась или сработал аварийный выключатель - начинаем заново
+	tripped := b.breaker.Tripped()
+	if !b.deal.BaseFilled && (tripped || time.Since(b.deal.CreatedAt) > baseOrderTimeout) {
+		return b.cancelBase(ctx)
+	}
+
+	// Сработал аварийный выключатель: страховочные ордера снимаются и выставятся после cooldown,
+	// тейк-профит остаётся
+	if tripped {
+		if err := b.cancelSafetyOrders(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Выставляем недостающие ордера (например, если не хватило лимита открытых ордеров)
+	if b.deal.BaseFilled {
+		if !tripped {
+			if err := b.placeSafetyOrders(ctx, openOrders); err != nil {
+				return err
+			}
+		}
+		if b.deal.TPOrderID == "" {
+			return b.replaceTakeProfit(ctx)
+		}
+	}
+	return nil
+}
+
+// HandleUpdate - исполнение ордера из лиснера ставится в очередь, чтобы лиснер
+// не ждал запросов к бирже, которые делает воркер под блокировкой сделки
+func (b *Bot) HandleUpdate(ctx context.Context, update exchange.OrderUpdate) {
+	switch update.Status {
+	case exchange.FullyTraded, exchange.PartiallyCanceled, exchange.PartiallyTraded:
+	default:
+		return
+	}
+	select {
+	case b.fills <- update:
+	default:
+		log.Printf("Очередь исполнений сделки заполнена, ордер %s обработает воркер", update.OrderId)
+		return
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.drainFills(ctx)
+	}()
+}
+
+// drainFills - обработка очереди исполнений. Лишние горутины находят очередь пустой
+func (b *Bot) drainFills(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		select {
+		case update := <-b.fills:
+			b.handleFill(ctx, update)
+		default:
+			return
+		}
+	}
+}
+
+// Wait - ожидание обработки исполнений, принятых из лиснера
+func (b *Bot) Wait() {
+	b.wg.Wait()
+}
+
+// handleFill - исполнение ордера сделки. Объём в обновлении накопительный,
+// поэтому частичные исполнения учитываются по приросту
+func (b *Bot) handleFill(ctx context.Context, update exchange.OrderUpdate) {
+	if b.deal == nil || !b.ownsOrder(update.OrderId) {
+		return
+	}
+	price, err := strconv.ParseFloat(update.Price, 64)
+	if err != nil {
+		b.logger.Error(fmt.Sprintf("Error parsing price: %v", err))
+		return
+	}
+	qty, err := strconv.ParseFloat(update.Quantity, 64)
+	if err != nil {
+		b.logger.Error(fmt.Sprintf("Error parsing quantity: %v", err))
+		return
+	}
+	if update.OrderId == b.deal.TPOrderID && update.Status == exchange.PartiallyCanceled {
+		// тейк-профит снят после частичного исполнения: остаток продаст новый тейк-профит
+		b.forgetOrder(ctx, update.OrderId, price, qty)
+	} else {
+		done := update.Status != exchange.PartiallyTraded
+		b.onFilled(ctx, update.OrderId, price, qty, done)
+	}
+	b.save(ctx)
+}
+
+// load - сделка, сохранённая до перезапуска
+func (b *Bot) load(ctx context.Context) error {
+	deal, err := b.dealRepo.GetDeal(ctx)
+	if errors.Is(err, repository.ErrDealNotFound) {
+		b.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b.deal = &deal
+	b.loaded = true
+	log.Printf("Сделка усреднения восстановлена: первая покупка %s, объём %.8f, средняя цена %.8f, тейк-профит %s",
+		deal.BaseOrderID, deal.FilledQty, deal.AvgPrice(), deal.TPOrderID)
+	return nil
+}
+
+// save - сохраняет сделку или удаляет закрытую, false - ошибка записи
+func (b *Bot) save(ctx context.Context) bool {
+	var err error
+	if b.deal == nil {
+		err = b.dealRepo.DeleteDeal(ctx)
+	} else {
+		err = b.dealRepo.SaveDeal(ctx, *b.deal)
+	}
+	if err != nil {
+		b.logger.Error(fmt.Sprintf("Ошибка сохранения сделки усреднения: %v", err))
+		return false
+	}
+	return true
+}
+
+// placeOrder - ордер сделки через журнал намерений. Намерение отмечается после сохранения
+// сделки с ордером, иначе при запуске несохранённый ордер отменит Replayer
+func (b *Bot) placeOrder(ctx context.Context, req exchange.SpotOrderRequest, apply func(orderID string)) (*exchange.OrderResponse, error) {
+	intentID, orderResp, err := b.outbox.PlaceOrder(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	apply(orderResp.OrderID)
+	if b.save(ctx) {
+		b.outbox.Done(ctx, intentID, orderResp.OrderID)
+	}
+	return orderResp, nil
+}
+
+// openDeal - первая покупка по текущей цене
+func (b *Bot) openDeal(ctx context.Context) error {
+	openOrders, err := b.exchange.GetOpenOrders(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+	buyCount, sellCount := sell_v1.GetCountOpenOrders(openOrders)
+	// Нужен запас под страховочные ордера и тейк-профит
+	if buyCount+sellCount+b.config.DCA.SafetyOrders+2 > exchange.MaxOpenOrders {
+		log.Printf("Превышено количество открытых ордеров: %d", buyCount+sellCount)
+		return nil
+	}
+
+	price, err := b.exchange.GetPrice(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+	accountInfo, err := b.exchange.GetAccountInfo(ctx)
+	if err != nil {
+		return err
+	}
+	usdtBalance, err := accountInfo.GetUsdtBalance()
+	if err != nil {
+		return err
+	}
+	if usdtBalance < b.config.DCA.BaseOrderSize*price {
+		log.Printf("Баланс usdt меньше размера первой покупки сделки, ожидание...")
+		return nil
+	}
+
+	order := exchange.SpotOrderRequest{
+		Symbol:   b.config.Symbol,
+		Side:     exchange.Buy,
+		Type:     exchange.Limit,
+		Quantity: b.config.DCA.BaseOrderSize,
+		Price:    price,
+	}
+	safety := make([]repository.DCASafetyOrder, b.config.DCA.SafetyOrders)
+	for i := range safety {
+		k := float64(i + 1)
+		safety[i] = repository.DCASafetyOrder{
+			Price: price * (1 - b.config.DCA.StepPercent*k/100),
+			Qty:   b.config.DCA.BaseOrderSize * math.Pow(b.config.DCA.SizeMultiplier, k),
+		}
+	}
+	orderResp, err := b.placeOrder(ctx, order, func(orderID string) {
+		b.deal = &repository.DCADeal{
+			BaseOrderID: orderID,
+			BasePrice:   price,
+			CreatedAt:   time.Now(),
+			Safety:      safety,
+		}
+	})
+	if errors.Is(err, exchange.ErrBlocked) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Новая сделка усреднения, первая покупка: %s Price=%s", orderResp.OrderID, orderResp.Price)
+	return nil
+}
+
+// cancelBase - отмена первой покупки по таймауту. Если она успела частично исполниться,
+// сделка продолжается с исполненным объёмом
+func (b *Bot) cancelBase(ctx context.Context) error {
+	d := b.deal
+	if err := b.outbox.CancelOrder(ctx, b.config.Symbol, d.BaseOrderID); err != nil {
+		return err
+	}
+	order, err := b.exchange.GetOrder(ctx, b.config.Symbol, d.BaseOrderID, "")
+	if err != nil {
+		// исполненный объём выяснит syncFills в следующем цикле
+		return err
+	}
+	executed, _ := strconv.ParseFloat(order.ExecutedQty, 64)
+	if executed > 0 {
+		price, _ := strconv.ParseFloat(order.Price, 64)
+		log.Printf("Первая покупка сделки отменена после частичного исполнения: %s", d.BaseOrderID)
+		b.onFilled(ctx, d.BaseOrderID, price, executed, true)
+		return nil
+	}
+	log.Printf("Первая покупка сделки не исполнилась и отменена: %s", d.BaseOrderID)
+	b.deal = nil
+	return nil
+}
+
+// cancelSafetyOrders - отмена стоящих страховочных ордеров. Исполненная часть
+// учитывается в сделке, неисполненные ордера будут выставлены заново
+func (b *Bot) cancelSafetyOrders(ctx context.Context) error {
+	for _, orderID := range b.activeOrderIDs() {
+		if orderID == b.deal.TPOrderID || orderID == b.deal.BaseOrderID {
+			continue
+		}
+		if err := b.outbox.CancelOrder(ctx, b.config.Symbol, orderID); err != nil {
+			return err
+		}
+		order, err := b.exchange.GetOrder(ctx, b.config.Symbol, orderID, "")
+		if err != nil {
+			// исполненный объём выяснит syncFills в следующем цикле
+			return err
+		}
+		price, _ := strconv.ParseFloat(order.Price, 64)
+		executed, _ := strconv.ParseFloat(order.ExecutedQty, 64)
+		log.Printf("Страховочный ордер %s снят аварийным выключателем, исполнено %.8f", orderID, executed)
+		b.forgetOrder(ctx, orderID, price, executed)
+	}
+	return nil
+}
+
+// syncFills - обработка исполнений и отмен, которые лиснер пропустил
+func (b *Bot) syncFills(ctx context.Context, openOrders []exchange.OrderInfo) error {
+	open := make(map[string]struct{}, len(openOrders))
+	for _, order := range openOrders {
+		open[order.OrderID] = struct{}{}
+	}
+
+	var missing bool
+	for _, orderID := range b.activeOrderIDs() {
+		if _, ok := open[orderID]; !ok {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return nil
+	}
+
+	now := time.Now()
+	startTime := b.deal.CreatedAt.Add(-time.Minute).UnixMilli()
+	allOrders, err := b.exchange.GetAllOrders(ctx, b.config.Symbol, startTime, now.UnixMilli())
+	if err != nil {
+		return err
+	}
+	for _, order := range allOrders {
+		if b.deal == nil {
+			return nil
+		}
+		if _, ok := open[order.OrderID]; ok || !b.ownsOrder(order.OrderID) {
+			continue
+		}
+		price, err := strconv.ParseFloat(order.Price, 64)
+		if err != nil {
+			return err
+		}
+		executed, err := strconv.ParseFloat(order.ExecutedQty, 64)
+		if err != nil {
+			return err
+		}
+		switch order.Status {
+		case exchange.Filled:
+			log.Printf("Ордер сделки %s исполнен (найден воркером)", order.OrderID)
+			b.onFilled(ctx, order.OrderID, price, executed, true)
+		case exchange.New, exchange.PartiallyFilled:
+			// ордер ещё жив, просто не попал в снимок открытых
+		default:
+			log.Printf("Ордер сделки %s больше не активен (статус: %s)", order.OrderID, order.Status)
+			b.forgetOrder(ctx, order.OrderID, price, executed)
+		}
+	}
+	return nil
+}
+
+// onFilled - пересчёт позиции по накопительному исполнению ордера сделки.
+// done - ордер больше не исполняется (исполнен полностью или отменён после частичного).
+// Тейк-профит, отменённый после частичного исполнения, учитывает forgetOrder
+func (b *Bot) onFilled(ctx context.Context, orderID string, price, executed float64, done bool) {
+	d := b.deal
+
+	if orderID == d.TPOrderID {
+		// частичное исполнение тейк-профита учитывается при его перестановке
+		if done {
+			b.closeDeal(ctx, price, executed)
+		}
+		return
+	}
+
+	delta := executed - b.executed(orderID)
+	baseDone := false
+	if orderID == d.BaseOrderID {
+		d.BaseExecuted = max(d.BaseExecuted, executed)
+		baseDone = done && !d.BaseFilled
+		d.BaseFilled = d.BaseFilled || done
+	} else {
+		for i := range d.Safety {
+			if d.Safety[i].OrderID == orderID {
+				d.Safety[i].Executed = max(d.Safety[i].Executed, executed)
+				d.Safety[i].Filled = d.Safety[i].Filled || done
+				break
+			}
+		}
+	}
+	if delta > 0 {
+		d.FilledQty += delta
+		d.FilledCost += price * delta
+		b.logger.Info(fmt.Sprintf("Покупка сделки исполнена: OrderId=%s, Price=%.8f, Qty=%.8f, средняя цена %.8f, объём %.8f",
+			orderID, price, delta, d.AvgPrice(), d.FilledQty))
+	}
+
+	if baseDone {
+		openOrders, err := b.exchange.GetOpenOrders(ctx, b.config.Symbol)
+		if err != nil {
+			b.logger.Error(fmt.Sprintf("Ошибка получения открытых ордеров: %v", err))
+		} else if err := b.placeSafetyOrders(ctx, openOrders); err != nil {
+			// недостающие страховочные ордера будут выставлены в следующем цикле воркера
+			b.logger.Error(fmt.Sprintf("Ошибка размещения страховочных ордеров: %v", err))
+		}
+	}
+	if delta > 0 && d.BaseFilled {
+		if err := b.replaceTakeProfit(ctx); err != nil {
+			b.logger.Error(fmt.Sprintf("Ошибка перестановки тейк-профита сделки: %v", err))
+		}
+	}
+}
+
+// placeSafetyOrders - выставляет ещё не размещённые страховочные ордера
+func (b *Bot) placeSafetyOrders(ctx context.Context, openOrders []exchange.OrderInfo) error {
+	buyCount, sellCount := sell_v1.GetCountOpenOrders(openOrders)
+	openCount := buyCount + sellCount
+
+	for i := range b.deal.Safety {
+		so := &b.deal.Safety[i]
+		if so.OrderID != "" || so.Filled {
+			continue
+		}
+		// Оставляем место под тейк-профит
+		if openCount+1 >= exchange.MaxOpenOrders {
+			log.Printf("Превышено количество открытых ордеров: %d", openCount)
+			return nil
+		}
+		order := exchange.SpotOrderRequest{
+			Symbol:   b.config.Symbol,
+			Side:     exchange.Buy,
+			Type:     exchange.Limit,
+			Quantity: so.Qty,
+			Price:    so.Price,
+		}
+		orderResp, err := b.placeOrder(ctx, order, func(orderID string) { so.OrderID = orderID })
+		if errors.Is(err, exchange.ErrBlocked) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		openCount++
+		log.Printf("Страховочный ордер #%d размещен: %s Price=%s Qty=%.8f", i+1, orderResp.OrderID, orderResp.Price, so.Qty)
+	}
+	return nil
+}
+
+// replaceTakeProfit - отменяет текущий тейк-профит и ставит новый от средней цены
+// на весь купленный объём за вычетом уже проданного прежними тейк-профитами
+func (b *Bot) replaceTakeProfit(ctx context.Context) error {
+	d := b.deal
+	if d.TPOrderID != "" {
+		if err := b.outbox.CancelOrder(ctx, b.config.Symbol, d.TPOrderID); err != nil {
+			return err
+		}
+		// если не удалось узнать проданное, тейк-профит остаётся в сделке и его учтёт syncFills
+		order, err := b.exchange.GetOrder(ctx, b.config.Symbol, d.TPOrderID, "")
+		if err != nil {
+			return err
+		}
+		price, _ := strconv.ParseFloat(order.Price, 64)
+		executed, _ := strconv.ParseFloat(order.ExecutedQty, 64)
+		log.Printf("Тейк-профит сделки отменён: %s, продано %.8f", d.TPOrderID, executed)
+		b.addSold(price, executed)
+		d.TPOrderID = ""
+	}
+
+	qty := d.FilledQty - d.SoldQty
+	tpPrice := d.AvgPrice() * (1 + b.config.DCA.TakeProfitPercent/100)
+	if qty*tpPrice < exchange.MinNotional {
+		log.Printf("Непроданный объём сделки меньше минимальной суммы: %.8f", qty)
+		return nil
+	}
+	sellOrder := exchange.SpotOrderRequest{
+		Symbol:   b.config.Symbol,
+		Side:     exchange.Sell,
+		Type:     exchange.Limit,
+		Quantity: qty,
+		Price:    tpPrice,
+	}
+	orderResp, err := b.placeOrder(ctx, sellOrder, func(orderID string) {
+		d.TPOrderID = orderID
+		d.TPPrice = tpPrice
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Тейк-профит сделки размещен: %s Price=%s Qty=%.8f avgPrice=%.8f", orderResp.OrderID, orderResp.Price, qty, d.AvgPrice())
+	return nil
+}
+
+// closeDeal - тейк-профит исполнен, снимаем оставшиеся страховочные ордера
+func (b *Bot) closeDeal(ctx context.Context, price, qty float64) {
+	d := b.deal
+	for _, so := range d.Safety {
+		if so.OrderID == "" || so.Filled {
+			continue
+		}
+		if err := b.outbox.CancelOrder(ctx, b.config.Symbol, so.OrderID); err != nil {
+			log.Printf("Ошибка отмены страховочного ордера %s: %v", so.OrderID, err)
+		}
+		if so.Executed > 0 {
+			log.Printf("Страховочный ордер %s исполнен частично, %.8f остаются на балансе", so.OrderID, so.Executed)
+		}
+	}
+	profit := price*qty + d.SoldAmount - d.FilledCost
+	b.logger.Info(fmt.Sprintf("Сделка усреднения закрыта: TP=%s, объём %.8f, средняя цена %.8f, прибыль %.4f USDT",
+		d.TPOrderID, d.SoldQty+qty, d.AvgPrice(), profit))
+	b.deal = nil
+}
+
+// addSold - учёт продажи отменённого тейк-профита
+func (b *Bot) addSold(price, qty float64) {
+	b.deal.SoldQty += qty
+	b.deal.SoldAmount += price * qty
+}
+
+// executed - уже учтённый исполненный объём покупки сделки
+func (b *Bot) executed(orderID string) float64 {
+	if orderID == b.deal.BaseOrderID {
+		return b.deal.BaseExecuted
+	}
+	for _, so := range b.deal.Safety {
+		if so.OrderID == orderID {
+			return so.Executed
+		}
+	}
+	return 0
+}
+
+// activeOrderIDs - ордера сделки, которые должны стоять на бирже
+func (b *Bot) activeOrderIDs() []string {
+	var ids []string
+	if !b.deal.BaseFilled && b.deal.BaseOrderID != "" {
+		ids = append(ids, b.deal.BaseOrderID)
+	}
+	for _, so := range b.deal.Safety {
+		if so.OrderID != "" && !so.Filled {
+			ids = append(ids, so.OrderID)
+		}
+	}
+	if b.deal.TPOrderID != "" {
+		ids = append(ids, b.deal.TPOrderID)
+	}
+	return ids
+}
+
+func (b *Bot) ownsOrder(orderID string) bool {
+	for _, id := range b.activeOrderIDs() {
+		if id == orderID {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetOrder - ордер отменён вне бота. Исполненная часть учитывается,
+// неисполненный ордер будет выставлен заново
+func (b *Bot) forgetOrder(ctx context.Context, orderID string, price, executed float64) {
+	d := b.deal
+	switch {
+	case orderID == d.TPOrderID:
+		b.addSold(price, executed)
+		d.TPOrderID = ""
+	case executed > 0:
+		b.onFilled(ctx, orderID, price, executed, true)
+	case orderID == d.BaseOrderID:
+		b.deal = nil
+	default:
+		for i := range d.Safety {
+			if d.Safety[i].OrderID == orderID {
+				d.Safety[i].OrderID = ""
+			}
+		}
+	}
+}
+
+func (b *Bot) Name() string {
+	return "dca_v1"
+}
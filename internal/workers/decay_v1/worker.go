@@ -0,0 +1,221 @@
+package decay_v1
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/fees"
+	"scalpingbot/internal/logger"
+	"scalpingbot/internal/outbox"
+	"scalpingbot/internal/repo"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/takeprofit"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// minPriceChange - не переставляем продажу, если цена меняется меньше чем на 0.01%
+const minPriceChange = 0.0001
+
+// Bot - снижает цель старых продаж к безубытку по расписанию возраста, чтобы
+// продажи, выставленные на локальном максимуме, не держали капитал неделями
+type Bot struct {
+	config    config.Config
+	exchange  exchange.Exchange
+	positions repo.PositionRepo
+	lots      repository.LotRepository
+	fees      *fees.Tracker // nil - комиссии не учитываются
+	outbox    *outbox.Outbox
+	placer    *takeprofit.Placer
+	logger    logger.Logger
+	schedule  []config.DecayStep
+}
+
+// NewBot - конструктор бота
+func NewBot(cfg config.Config, ex exchange.Exchange, positions repo.PositionRepo, lots repository.LotRepository,
+	feeTracker *fees.Tracker, ob *outbox.Outbox, placer *takeprofit.Placer, logLogger logger.Logger) *Bot {
+	schedule := append([]config.DecayStep(nil), cfg.Decay.Schedule...)
+	sort.Slice(schedule, func(i, j int) bool { return schedule[i].AfterHours < schedule[j].AfterHours })
+	return &Bot{
+		config:    cfg,
+		exchange:  ex,
+		positions: positions,
+		lots:      lots,
+		fees:      feeTracker,
+		outbox:    ob,
+		placer:    placer,
+		logger:    logLogger,
+		schedule:  schedule,
+	}
+}
+
+func (b *Bot) Process(ctx context.Context) error {
+	lots, err := b.lots.GetLotsByState(ctx, repository.LotSellPlaced)
+	if err != nil {
+		return err
+	}
+	if len(lots) == 0 {
+		return nil
+	}
+	openOrders, err := b.exchange.GetOpenOrders(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+	open := make(map[string]exchange.OrderInfo, len(openOrders))
+	for _, order := range openOrders {
+		open[order.OrderID] = order
+	}
+
+	// Лоты одной продажи (после объединения) дают средневзвешенный вход и возраст самого старого
+	type sellGroup struct {
+		qty, amount float64
+		openedAt    time.Time
+	}
+	groups := make(map[string]*sellGroup)
+	for _, lot := range lots {
+		g, ok := groups[lot.SellOrderID]
+		if !ok {
+			g = &sellGroup{openedAt: lot.CreatedTime()}
+			groups[lot.SellOrderID] = g
+		}
+		g.qty += lot.BuyQty
+		g.amount += lot.BuyQty * lot.BuyPrice
+		if created := lot.CreatedTime(); created.Before(g.openedAt) {
+			g.openedAt = created
+		}
+	}
+
+	for sellOrderID, g := range groups {
+		order, ok := open[sellOrderID]
+		if !ok || order.Status != exchange.New || g.qty <= 0 {
+			continue
+		}
+		// Защитные ордера трейлинга ведёт trailing_v1
+		if p, ok := b.positions.Get(sellOrderID); ok && p.Trailing {
+			continue
+		}
+		pct, ok := b.targetPercent(time.Since(g.openedAt))
+		if !ok {
+			continue
+		}
+		entry := g.amount / g.qty
+		// Цель - чистый результат: с комиссиями цена продажи выше на комиссии обеих сторон
+		target := entry * (1 + pct/100)
+		if b.fees != nil {
+			target = b.fees.SellPrice(ctx, entry, pct)
+		}
+		current, err := strconv.ParseFloat(order.Price, 64)
+		if err != nil {
+			continue
+		}
+		if target >= current*(1-minPriceChange) {
+			continue
+		}
+		if err := b.replace(ctx, order, entry, target, pct); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// targetPercent - процент цели для возраста продажи: последний наступивший шаг
+// расписания, не ниже floor_percent. false - снижать ещё рано
+func (b *Bot) targetPercent(age time.Duration) (float64, bool) {
+	hours := age.Hours()
+	pct, found := 0.0, false
+	for _, step := range b.schedule {
+		if hours < step.AfterHours {
+			break
+		}
+		pct, found = step.Percent, true
+	}
+	if !found {
+		return 0, false
+	}
+	return math.Max(pct, b.config.Decay.FloorPercent), true
+}
+
+// replace - переставляет продажу на новую цель, переносит лоты журнала и позицию
+func (b *Bot) replace(ctx context.Context, order exchange.OrderInfo, entry, target, pct float64) error {
+	qty, err := strconv.ParseFloat(order.OrigQty, 64)
+	if err != nil {
+		return err
+	}
+	oldPrice, err := strconv.ParseFloat(order.Price, 64)
+	if err != nil {
+		return err
+	}
+	if err := b.outbox.CancelOrder(ctx, b.config.Symbol, order.OrderID); err != nil {
+		// скорее всего продажа уже исполнена
+		log.Printf("Ошибка отмены старой продажи %s: %v", order.OrderID, err)
+		return nil
+	}
+	// продажа могла исполниться частично после получения списка открытых: переставляем только остаток
+	remaining, err := b.placer.SettleCanceled(ctx, order.OrderID, qty)
+	if err != nil {
+		return b.restore(ctx, order.OrderID, qty, oldPrice, err)
+	}
+	if remaining == 0 {
+		b.positions.Remove(order.OrderID)
+		return nil
+	}
+
+	orderResp, err := b.placeSell(ctx, order.OrderID, remaining, target)
+	if err != nil {
+		return b.restore(ctx, order.OrderID, remaining, oldPrice, err)
+	}
+	if p, ok := b.positions.Get(order.OrderID); ok {
+		b.positions.Remove(order.OrderID)
+		p.SellOrderID = orderResp.OrderID
+		p.Qty = remaining
+		p.TargetPrice = target
+		p.TargetPercent = pct
+		p.SellPrice = target
+		b.positions.Add(p)
+	}
+	log.Printf("Цель старой продажи снижена: %s -> %s вход=%.8f цена %s -> %.8f (%.3f%%)",
+		order.OrderID, orderResp.OrderID, entry, order.Price, target, pct)
+	return nil
+}
+
+// restore - продажа уже снята: сразу возвращаем её по прежней цене, иначе монеты останутся без продажи
+func (b *Bot) restore(ctx context.Context, sellOrderID string, qty, price float64, cause error) error {
+	restored, err := b.placer.RestoreSell(ctx, sellOrderID, qty, price)
+	if err != nil {
+		b.logger.Error(fmt.Sprintf("Ошибка перестановки старой продажи %s, продажа снята: %v; возврат по прежней цене: %v",
+			sellOrderID, cause, err))
+		return cause
+	}
+	log.Printf("Ошибка перестановки старой продажи %s, возвращена по прежней цене: %s", sellOrderID, restored.OrderID)
+	return cause
+}
+
+// placeSell - продажа взамен снятой oldSellOrderID с переносом лотов журнала.
+// Если ответ не дошёл, при запуске Replayer перенесёт лоты или вернёт их в FILLED
+func (b *Bot) placeSell(ctx context.Context, oldSellOrderID string, qty, price float64) (*exchange.OrderResponse, error) {
+	sellOrder := exchange.SpotOrderRequest{
+		Symbol:   b.config.Symbol,
+		Side:     exchange.Sell,
+		Type:     exchange.Limit,
+		Quantity: qty,
+		Price:    price,
+	}
+	intentID, orderResp, err := b.outbox.ReplaceSell(ctx, oldSellOrderID, sellOrder)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.lots.ReplaceSellOrder(ctx, oldSellOrderID, orderResp.OrderID, price); err != nil {
+		log.Printf("Ошибка переноса лотов продажи %s на %s: %v", oldSellOrderID, orderResp.OrderID, err)
+	} else {
+		b.outbox.Done(ctx, intentID, orderResp.OrderID)
+	}
+	return orderResp, nil
+}
+
+func (b *Bot) Name() string {
+	return "decay_v1"
+}
@@ -0,0 +1,444 @@
+package grid_v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"scalpingbot/internal/breaker"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/logger"
+	"scalpingbot/internal/outbox"
+	"scalpingbot/internal/repo"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/tgbot"
+	"scalpingbot/internal/workers/sell_v1"
+	"sync"
+	"time"
+)
+
+// Bot - сеточная стратегия: покупки ниже рынка, продажи выше,
+// на каждое исполнение ставится встречный ордер на соседнем уровне
+type Bot struct {
+	config   config.Config
+	exchange exchange.Exchange
+	storage  repo.Repo
+	gridRepo repository.GridRepository
+	outbox   *outbox.Outbox
+	logger   logger.Logger
+	breaker  *breaker.Breaker
+
+	// mu держится на время запросов к бирже, поэтому исполнения из лиснера
+	// ставятся в очередь fills и обрабатываются отдельной горутиной
+	mu     sync.Mutex
+	loaded bool
+	state  repository.GridState
+	levels []repository.GridLevel
+
+	fills chan string
+	wg    sync.WaitGroup
+}
+
+// fillsBuffer - размер очереди исполнений. Исполнения сверх неё найдёт syncFills
+const fillsBuffer = 100
+
+// NewBot - конструктор бота
+func NewBot(cfg config.Config, ex exchange.Exchange, storage repo.Repo, gridRepo repository.GridRepository,
+	ob *outbox.Outbox, logLogger logger.Logger, circuitBreaker *breaker.Breaker) *Bot {
+	return &Bot{
+		config:   cfg,
+		exchange: ex,
+		storage:  storage,
+		gridRepo: gridRepo,
+		outbox:   ob,
+		logger:   logLogger,
+		breaker:  circuitBreaker,
+		fills:    make(chan string, fillsBuffer),
+	}
+}
+
+func (b *Bot) Process(ctx context.Context) error {
+	// заглушка для переключения статуса бота
+	if !b.storage.Has(tgbot.WorkerStatusKey) {
+		log.Printf("Воркер %s в тг спящем режиме", b.Name())
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	price, err := b.exchange.GetPrice(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+
+	if !b.loaded {
+		if err := b.load(ctx, price); err != nil {
+			return err
+		}
+	}
+
+	openOrders, err := b.exchange.GetOpenOrders(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+	if err := b.syncFills(ctx, openOrders); err != nil {
+		return err
+	}
+
+	// Сработал аварийный выключатель: покупки сетки снимаются и выставятся после cooldown
+	tripped := b.breaker.Tripped()
+	if tripped {
+		b.cancelBuys(ctx, openOrders)
+	}
+
+	// Цена вышла за диапазон сетки
+	if price < b.state.LowerPrice || price > b.state.UpperPrice {
+		if !b.config.Grid.Recenter {
+			log.Printf("Цена %.8f вне диапазона сетки %.8f - %.8f", price, b.state.LowerPrice, b.state.UpperPrice)
+			return nil
+		}
+		if err := b.recenter(ctx, price); err != nil {
+			return err
+		}
+		// после отмены ордеров список открытых изменился
+		openOrders, err = b.exchange.GetOpenOrders(ctx, b.config.Symbol)
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.placeMissing(ctx, openOrders, tripped)
+}
+
+// HandleUpdate - исполнение ордера из лиснера ставится в очередь, чтобы лиснер
+// не ждал запросов к бирже, которые делает воркер под блокировкой сетки
+func (b *Bot) HandleUpdate(ctx context.Context, update exchange.OrderUpdate) {
+	if update.Status != exchange.FullyTraded {
+		return
+	}
+	select {
+	case b.fills <- update.OrderId:
+	default:
+		log.Printf("Очередь исполнений сетки заполнена, ордер %s обработает воркер", update.OrderId)
+		return
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.drainFills(ctx)
+	}()
+}
+
+// drainFills - обработка очереди исполнений. Лишние горутины находят очередь пустой
+func (b *Bot) drainFills(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		select {
+		case orderID := <-b.fills:
+			for i := range b.levels {
+				if b.levels[i].OrderID == orderID {
+					b.logger.Info(fmt.Sprintf("Исполнен ордер сетки: OrderId=%s, уровень %d", orderID, i))
+					b.onFilled(ctx, i)
+					break
+				}
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Wait - ожидание обработки исполнений, принятых из лиснера
+func (b *Bot) Wait() {
+	b.wg.Wait()
+}
+
+// load - загрузка сетки из базы или построение новой
+func (b *Bot) load(ctx context.Context, price float64) error {
+	state, levels, err := b.gridRepo.GetGrid(ctx)
+	if err != nil && !errors.Is(err, repository.ErrGridNotFound) {
+		return err
+	}
+
+	if err == nil && state.Symbol == b.config.Symbol && state.Levels == b.config.Grid.Levels &&
+		state.ConfigLower == b.config.Grid.LowerPrice && state.ConfigUpper == b.config.Grid.UpperPrice &&
+		len(levels) == state.Levels {
+		b.state = state
+		b.levels = levels
+		b.loaded = true
+		log.Printf("Сетка восстановлена: %.8f - %.8f, уровней: %d", state.LowerPrice, state.UpperPrice, state.Levels)
+		return nil
+	}
+
+	// Настройки сетки поменялись - снимаем ордера старой сетки
+	if err == nil {
+		b.levels = levels
+		b.cancelAll(ctx)
+	}
+
+	b.state = repository.GridState{
+		Symbol:      b.config.Symbol,
+		LowerPrice:  b.config.Grid.LowerPrice,
+		UpperPrice:  b.config.Grid.UpperPrice,
+		Levels:      b.config.Grid.Levels,
+		ConfigLower: b.config.Grid.LowerPrice,
+		ConfigUpper: b.config.Grid.UpperPrice,
+	}
+	if err := b.build(ctx, price); err != nil {
+		return err
+	}
+	b.loaded = true
+	return nil
+}
+
+// build - расставляет стороны уровней относительно текущей цены и сохраняет сетку
+func (b *Bot) build(ctx context.Context, price float64) error {
+	step := (b.state.UpperPrice - b.state.LowerPrice) / float64(b.state.Levels-1)
+	b.levels = make([]repository.GridLevel, b.state.Levels)
+
+	// Ближайший к цене уровень остаётся свободным
+	nearest := 0
+	for i := range b.levels {
+		levelPrice := b.state.LowerPrice + step*float64(i)
+		b.levels[i] = repository.GridLevel{Index: i, Price: levelPrice}
+		if math.Abs(levelPrice-price) < math.Abs(b.levels[nearest].Price-price) {
+			nearest = i
+		}
+	}
+	for i := range b.levels {
+		switch {
+		case i < nearest:
+			b.levels[i].Side = exchange.Buy
+		case i > nearest:
+			b.levels[i].Side = exchange.Sell
+		}
+	}
+
+	log.Printf("Построена сетка: %.8f - %.8f, уровней: %d, шаг: %.8f", b.state.LowerPrice, b.state.UpperPrice, b.state.Levels, step)
+	return b.gridRepo.SaveGrid(ctx, b.state, b.levels)
+}
+
+// recenter - перестраивает сетку той же ширины вокруг текущей цены
+func (b *Bot) recenter(ctx context.Context, price float64) error {
+	b.cancelAll(ctx)
+
+	width := b.state.UpperPrice - b.state.LowerPrice
+	lower := price - width/2
+	if lower <= 0 {
+		lower = price / 2
+	}
+	b.state.LowerPrice = lower
+	b.state.UpperPrice = lower + width
+
+	b.logger.Warn(fmt.Sprintf("Цена %.8f вышла за диапазон сетки, перестраиваем: %.8f - %.8f", price, b.state.LowerPrice, b.state.UpperPrice))
+	return b.build(ctx, price)
+}
+
+// cancelAll - отмена всех стоящих ордеров сетки
+func (b *Bot) cancelAll(ctx context.Context) {
+	for i := range b.levels {
+		if b.levels[i].OrderID == "" {
+			continue
+		}
+		if err := b.outbox.CancelOrder(ctx, b.config.Symbol, b.levels[i].OrderID); err != nil {
+			log.Printf("Ошибка отмены ордера сетки %s: %v", b.levels[i].OrderID, err)
+		}
+		b.levels[i].OrderID = ""
+	}
+}
+
+// cancelBuys - отмена стоящих покупок сетки, уровни остаются покупками без ордера.
+// Частично исполненные покупки не отменяются: исполненную часть сетка не учитывает
+func (b *Bot) cancelBuys(ctx context.Context, openOrders []exchange.OrderInfo) {
+	partial := make(map[string]struct{})
+	for _, order := range openOrders {
+		if order.Status != exchange.New {
+			partial[order.OrderID] = struct{}{}
+		}
+	}
+	for i := range b.levels {
+		if b.levels[i].Side != exchange.Buy || b.levels[i].OrderID == "" {
+			continue
+		}
+		if _, ok := partial[b.levels[i].OrderID]; ok {
+			continue
+		}
+		if err := b.outbox.CancelOrder(ctx, b.config.Symbol, b.levels[i].OrderID); err != nil {
+			log.Printf("Ошибка отмены покупки сетки %s: %v", b.levels[i].OrderID, err)
+			continue
+		}
+		log.Printf("Покупка сетки %s снята аварийным выключателем, уровень %d", b.levels[i].OrderID, i)
+		b.levels[i].OrderID = ""
+		b.saveLevel(ctx, i)
+	}
+}
+
+// syncFills - обработка ордеров сетки, исчезнувших из открытых (если лиснер их пропустил)
+func (b *Bot) syncFills(ctx context.Context, openOrders []exchange.OrderInfo) error {
+	open := make(map[string]struct{}, len(openOrders))
+	for _, order := range openOrders {
+		open[order.OrderID] = struct{}{}
+	}
+
+	var missing bool
+	for _, level := range b.levels {
+		if _, ok := open[level.OrderID]; level.OrderID != "" && !ok {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return nil
+	}
+
+	now := time.Now()
+	allOrders, err := b.exchange.GetAllOrders(ctx, b.config.Symbol, now.Add(-24*time.Hour).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return err
+	}
+	statuses := make(map[string]string, len(allOrders))
+	for _, order := range allOrders {
+		statuses[order.OrderID] = order.Status
+	}
+
+	// Снимок ордеров до обработки: onFilled выставляет новые ордера на соседних уровнях
+	orderIDs := make([]string, len(b.levels))
+	for i := range b.levels {
+		orderIDs[i] = b.levels[i].OrderID
+	}
+
+	for i, orderID := range orderIDs {
+		if _, ok := open[orderID]; orderID == "" || ok || b.levels[i].OrderID != orderID {
+			continue
+		}
+		switch statuses[orderID] {
+		case exchange.Filled:
+			log.Printf("Ордер сетки %s исполнен (найден воркером), уровень %d", orderID, i)
+			b.onFilled(ctx, i)
+		case exchange.New, exchange.PartiallyFilled:
+			// ордер ещё жив, просто не попал в снимок открытых
+		default:
+			// отменён вручную или не найден - уровень будет выставлен заново
+			log.Printf("Ордер сетки %s не найден среди открытых (статус: %q), уровень %d освобождён", orderID, statuses[orderID], i)
+			b.levels[i].OrderID = ""
+			b.saveLevel(ctx, i)
+		}
+	}
+	return nil
+}
+
+// onFilled - уровень освобождается, встречный ордер ставится на соседний уровень
+func (b *Bot) onFilled(ctx context.Context, i int) {
+	side := b.levels[i].Side
+	b.levels[i].Side = ""
+	b.levels[i].OrderID = ""
+	b.saveLevel(ctx, i)
+
+	next := i + 1
+	nextSide := exchange.Sell
+	if side == exchange.Sell {
+		next = i - 1
+		nextSide = exchange.Buy
+	}
+	if next < 0 || next >= len(b.levels) {
+		log.Printf("Исполнен крайний уровень сетки %d, встречный ордер не ставится", i)
+		return
+	}
+
+	if b.levels[next].OrderID != "" {
+		if err := b.outbox.CancelOrder(ctx, b.config.Symbol, b.levels[next].OrderID); err != nil {
+			log.Printf("Ошибка отмены ордера сетки %s: %v", b.levels[next].OrderID, err)
+		}
+	}
+	b.levels[next].Side = nextSide
+	b.levels[next].OrderID = ""
+	if err := b.placeLevel(ctx, next); err != nil {
+		// уровень останется без ордера и будет выставлен в следующем цикле воркера
+		if errors.Is(err, exchange.ErrBlocked) {
+			log.Printf("Встречная покупка сетки на уровне %d заблокирована: %v", next, err)
+			return
+		}
+		b.logger.Error(fmt.Sprintf("Ошибка размещения встречного ордера сетки на уровне %d: %v", next, err))
+	}
+}
+
+// placeMissing - выставляет ордера на всех уровнях, где их нет. При сработавшем
+// выключателе (tripped) выставляются только продажи
+func (b *Bot) placeMissing(ctx context.Context, openOrders []exchange.OrderInfo, tripped bool) error {
+	buyCount, sellCount := sell_v1.GetCountOpenOrders(openOrders)
+	openCount := buyCount + sellCount
+
+	accountInfo, err := b.exchange.GetAccountInfo(ctx)
+	if err != nil {
+		return err
+	}
+	kasFreeBalance, err := accountInfo.GetKasBalance()
+	if err != nil {
+		return err
+	}
+
+	for i := range b.levels {
+		if b.levels[i].Side == "" || b.levels[i].OrderID != "" || tripped && b.levels[i].Side == exchange.Buy {
+			continue
+		}
+		// Проверяем, что не превышено количество открытых ордеров
+		if openCount >= exchange.MaxOpenOrders {
+			log.Printf("Превышено количество открытых ордеров: %d", openCount)
+			return nil
+		}
+		if b.levels[i].Side == exchange.Sell {
+			if kasFreeBalance < b.config.Grid.OrderSize {
+				log.Printf("Недостаточно KAS для продажи на уровне сетки %d", i)
+				continue
+			}
+			kasFreeBalance -= b.config.Grid.OrderSize
+		}
+		if err := b.placeLevel(ctx, i); err != nil {
+			if errors.Is(err, exchange.ErrBlocked) {
+				// покупки запрещены лимитами, продажи выставляем дальше
+				continue
+			}
+			return err
+		}
+		openCount++
+	}
+	return nil
+}
+
+// placeLevel - размещает ордер уровня и сохраняет его
+func (b *Bot) placeLevel(ctx context.Context, i int) error {
+	order := exchange.SpotOrderRequest{
+		Symbol:   b.config.Symbol,
+		Side:     b.levels[i].Side,
+		Type:     exchange.Limit,
+		Quantity: b.config.Grid.OrderSize,
+		Price:    b.levels[i].Price,
+	}
+	intentID, orderResp, err := b.outbox.PlaceOrder(ctx, order)
+	if err != nil {
+		return err
+	}
+	b.levels[i].OrderID = orderResp.OrderID
+	if b.saveLevel(ctx, i) {
+		b.outbox.Done(ctx, intentID, orderResp.OrderID)
+	}
+	log.Printf("Ордер сетки размещен: %s Side=%s Price=%s уровень %d", orderResp.OrderID, order.Side, orderResp.Price, i)
+	return nil
+}
+
+// saveLevel - сохраняет уровень, false - ошибка записи
+func (b *Bot) saveLevel(ctx context.Context, i int) bool {
+	if err := b.gridRepo.UpdateLevel(ctx, b.levels[i]); err != nil {
+		b.logger.Error(fmt.Sprintf("Ошибка сохранения уровня сетки %d: %v", i, err))
+		return false
+	}
+	return true
+}
+
+func (b *Bot) Name() string {
+	return "grid_v1"
+}
@@ -0,0 +1,304 @@
+package ladder_v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"scalpingbot/internal/breaker"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/outbox"
+	"scalpingbot/internal/repo"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/schedule"
+	"scalpingbot/internal/sizing"
+	"scalpingbot/internal/takeprofit"
+	"scalpingbot/internal/tgbot"
+	"scalpingbot/internal/tools"
+	"scalpingbot/internal/workers/sell_v1"
+	"strconv"
+)
+
+// Bot - лесенка покупок: levels покупок ниже рынка с шагом step_percent.
+// Покупки лежат в состояниях покупок и журнале как обычные покупки buy_v1, поэтому
+// исполнения продаются лиснером и sell_v1 по обычному тейк-профиту. Старые покупки лесенки
+// sell_v1 не отменяет - их снимает этот воркер при перестройке
+type Bot struct {
+	config   config.Config
+	exchange exchange.Exchange
+	storage  repo.Repo
+	orders   repo.OrderStateRepo
+	lots     repository.LotRepository
+	sizer    *sizing.Sizer
+	schedule *schedule.Schedule
+	outbox   *outbox.Outbox
+	placer   *takeprofit.Placer
+	breaker  *breaker.Breaker
+
+	loaded bool
+	anchor float64 // цена, от которой построена лесенка
+	levels []level
+}
+
+// level - ступень лесенки. Исполненная ступень не выставляется повторно до перестройки
+type level struct {
+	price   float64
+	orderID string
+	filled  bool
+}
+
+// NewBot - конструктор бота
+func NewBot(cfg config.Config, ex exchange.Exchange, storage repo.Repo, orders repo.OrderStateRepo, lots repository.LotRepository,
+	sizer *sizing.Sizer, sched *schedule.Schedule, ob *outbox.Outbox, placer *takeprofit.Placer,
+	circuitBreaker *breaker.Breaker) *Bot {
+	return &Bot{
+		config:   cfg,
+		exchange: ex,
+		storage:  storage,
+		orders:   orders,
+		lots:     lots,
+		sizer:    sizer,
+		schedule: sched,
+		outbox:   ob,
+		placer:   placer,
+		breaker:  circuitBreaker,
+	}
+}
+
+func (b *Bot) Process(ctx context.Context) error {
+	// заглушка для переключения статуса бота
+	if !b.storage.Has(tgbot.WorkerStatusKey) {
+		log.Printf("Воркер %s в тг спящем режиме", b.Name())
+		return nil
+	}
+
+	price, err := b.exchange.GetPrice(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+	openOrders, err := b.exchange.GetOpenOrders(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+	open := make(map[string]exchange.OrderInfo, len(openOrders))
+	for _, order := range openOrders {
+		open[order.OrderID] = order
+	}
+
+	if !b.loaded {
+		b.load(price, openOrders)
+	}
+
+	// Ступени, которых больше нет среди открытых, исполнены или отменены - их обработал лиснер
+	for i := range b.levels {
+		if b.levels[i].orderID == "" {
+			continue
+		}
+		if _, ok := open[b.levels[i].orderID]; !ok {
+			log.Printf("Покупка лесенки %s по %.8f закрыта", b.levels[i].orderID, b.levels[i].price)
+			b.levels[i].orderID = ""
+			b.levels[i].filled = true
+		}
+	}
+
+	// Покупки запрещены расписанием или аварийным выключателем: снимаем лесенку,
+	// она выставится заново от цены после паузы
+	profile := b.schedule.Active()
+	if tripped := b.breaker.Tripped(); !profile.Buy || tripped {
+		if b.hasOrders() {
+			if tripped {
+				log.Printf("Сработал аварийный выключатель, лесенка снята")
+			} else {
+				log.Printf("Покупки выключены расписанием (профиль %s), лесенка снята", profile.Name)
+			}
+		}
+		kept, err := b.cancelLevels(ctx, price, open)
+		if err != nil {
+			return err
+		}
+		b.build(price, kept)
+		return nil
+	}
+
+	if change := math.Abs(price-b.anchor) / b.anchor * 100; change >= b.config.Ladder.RefreshPercent {
+		log.Printf("Цена %.8f ушла от лесенки %.8f на %.2f%%, перестраиваем", price, b.anchor, change)
+		kept, err := b.cancelLevels(ctx, price, open)
+		if err != nil {
+			return err
+		}
+		b.build(price, kept)
+	}
+
+	return b.placeMissing(ctx, openOrders)
+}
+
+// hasOrders - есть ли выставленные ступени
+func (b *Bot) hasOrders() bool {
+	for _, l := range b.levels {
+		if l.orderID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// load - при старте забирает в лесенку покупки бота, которые остались на бирже.
+// Они не совпадают со ступенями новой лесенки и будут отменены при первой перестройке
+func (b *Bot) load(price float64, openOrders []exchange.OrderInfo) {
+	b.build(price, nil)
+	for _, order := range openOrders {
+		if order.Side != exchange.Buy || !b.orders.Tracked(order.OrderID) {
+			continue
+		}
+		orderPrice, _ := strconv.ParseFloat(order.Price, 64)
+		b.levels = append(b.levels, level{price: orderPrice, orderID: order.OrderID})
+		log.Printf("Покупка %s по %.8f добавлена в лесенку", order.OrderID, orderPrice)
+	}
+	b.loaded = true
+}
+
+// build - новые ступени от цены price. kept - частично исполненные покупки старой лесенки,
+// они остаются в лесенке, пока не закроются или не окажутся ниже новой лесенки
+func (b *Bot) build(price float64, kept []level) {
+	b.anchor = price
+	b.levels = make([]level, 0, b.config.Ladder.Levels+len(kept))
+	for i := 0; i < b.config.Ladder.Levels; i++ {
+		percent := b.config.Ladder.OffsetPercent + b.config.Ladder.StepPercent*float64(i)
+		b.levels = append(b.levels, level{price: price * (1 - percent/100)})
+	}
+	b.levels = append(b.levels, kept...)
+}
+
+// cancelLevels - отменяет покупки лесенки перед перестройкой от цены price. Частично исполненные
+// в пределах новой лесенки остаются на бирже и возвращаются, чтобы она продолжала их отслеживать.
+// Ниже новой лесенки цена до них уже не дойдёт: они отменяются с продажей исполненной части
+func (b *Bot) cancelLevels(ctx context.Context, price float64, open map[string]exchange.OrderInfo) ([]level, error) {
+	percent := b.config.Ladder.OffsetPercent + b.config.Ladder.StepPercent*float64(b.config.Ladder.Levels-1)
+	lowest := price * (1 - percent/100)
+
+	var kept []level
+	for _, l := range b.levels {
+		if l.orderID == "" {
+			continue
+		}
+		if order, ok := open[l.orderID]; ok && order.Status != exchange.New {
+			if l.price >= lowest {
+				log.Printf("Покупка лесенки %s частично исполнена, не отменяем", l.orderID)
+				kept = append(kept, l)
+				continue
+			}
+			canceled, orderResp, err := b.placer.CancelPartial(ctx, l.orderID, l.price)
+			if canceled {
+				log.Printf("Частично исполненная покупка лесенки отменена: %s по %.8f", l.orderID, l.price)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if orderResp != nil {
+				log.Printf("Ордер на продажу от частичного: %s Price=%s", orderResp.OrderID, orderResp.Price)
+			}
+			continue
+		}
+		// Отмена в состояниях покупок и журнале обрабатывается лиснером
+		if err := b.outbox.CancelOrder(ctx, b.config.Symbol, l.orderID); err != nil {
+			return nil, fmt.Errorf("ошибка отмены покупки лесенки %s: %w", l.orderID, err)
+		}
+		log.Printf("Покупка лесенки отменена: %s по %.8f", l.orderID, l.price)
+	}
+	return kept, nil
+}
+
+// placeMissing - выставляет пустые ступени одной пачкой в пределах лимита открытых ордеров и баланса
+func (b *Bot) placeMissing(ctx context.Context, openOrders []exchange.OrderInfo) error {
+	var missing []int
+	for i, l := range b.levels {
+		if l.orderID == "" && !l.filled {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	buyCount, sellCount := sell_v1.GetCountOpenOrders(openOrders)
+	if free := exchange.MaxOpenOrders - buyCount - sellCount; len(missing) > free {
+		log.Printf("Превышено количество открытых ордеров: %d, выставляем %d ступеней из %d", buyCount+sellCount, max(free, 0), len(missing))
+		missing = missing[:max(free, 0)]
+	}
+
+	accountInfo, err := b.exchange.GetAccountInfo(ctx)
+	if err != nil {
+		return err
+	}
+	usdtBalance, err := accountInfo.GetUsdtBalance()
+	if err != nil {
+		return err
+	}
+
+	// Цены ступеней округляются вниз до шага цены пары
+	tick := 0.0
+	if info := b.sizer.SymbolInfo(ctx); info != nil {
+		tick = info.TickSize()
+	}
+
+	var reqs []exchange.SpotOrderRequest
+	for _, i := range missing {
+		if tick > 0 {
+			b.levels[i].price = math.Floor(b.levels[i].price/tick+1e-9) * tick
+		}
+		qty, err := b.sizer.Quantity(ctx, b.levels[i].price, accountInfo)
+		if err != nil {
+			return err
+		}
+		if usdtBalance < qty*b.levels[i].price {
+			log.Printf("Баланс usdt меньше размера ступени лесенки, выставлено %d из %d", len(reqs), len(missing))
+			break
+		}
+		usdtBalance -= qty * b.levels[i].price
+		reqs = append(reqs, exchange.SpotOrderRequest{
+			Symbol:   b.config.Symbol,
+			Side:     exchange.Buy,
+			Type:     exchange.Limit,
+			Quantity: qty,
+			Price:    b.levels[i].price,
+		})
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	// ордера, созданные до ошибки посреди пачки, тоже стоят на бирже и должны попасть в лесенку
+	// если процесс упадёт до записи в журнал, покупки запишет Replayer при запуске
+	intentIDs, responses, err := b.outbox.PlaceBuys(ctx, reqs)
+	for n, orderResp := range responses {
+		if orderResp.OrderID == "" {
+			continue
+		}
+		i := missing[n]
+		b.levels[i].orderID = orderResp.OrderID
+		b.orders.Track(orderResp.OrderID)
+		_, err := b.lots.CreateLot(ctx, repository.Lot{
+			Symbol:     b.config.Symbol,
+			BuyOrderID: orderResp.OrderID,
+			BuyPrice:   reqs[n].Price,
+			BuyQty:     reqs[n].Quantity,
+		})
+		if err != nil {
+			tools.LogErrorf("Ошибка записи покупки %s в журнал: %v", orderResp.OrderID, err)
+		} else {
+			b.outbox.Done(ctx, intentIDs[n], orderResp.OrderID)
+		}
+		log.Printf("Покупка лесенки размещена: %s Price=%s", orderResp.OrderID, orderResp.Price)
+	}
+	if errors.Is(err, exchange.ErrBlocked) {
+		// причина уже залогирована риск-менеджером
+		return nil
+	}
+	return err
+}
+
+func (b *Bot) Name() string {
+	return "ladder_v1"
+}
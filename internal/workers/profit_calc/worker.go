@@ -63,7 +63,10 @@ func (b *Bot) Process(ctx context.Context) error {
 			break
 		}
 
-		time.Sleep(500 * time.Millisecond) // для обхода rate-limit
+		// для обхода rate-limit
+		if err := tools.Sleep(ctx, 500*time.Millisecond); err != nil {
+			return err
+		}
 	}
 
 	b.storage.Add(repo.ProfitKey, tools.CalculateSellVolumeInUSDT(allOrders)*(b.config.ProfitPercent/100))
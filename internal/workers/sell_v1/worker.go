@@ -2,10 +2,15 @@ package sell_v1
 
 import (
 	"context"
+	"errors"
 	"log"
 	"scalpingbot/internal/config"
 	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/outbox"
 	"scalpingbot/internal/repo"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/takeprofit"
+	"scalpingbot/internal/tools"
 	"strconv"
 	"time"
 )
@@ -17,15 +22,22 @@ type WorkerFunc func(ctx context.Context) error
 type Bot struct {
 	config   config.Config
 	exchange exchange.Exchange
-	storage  repo.Repo
+	orders   repo.OrderStateRepo
+	lots     repository.LotRepository
+	placer   *takeprofit.Placer
+	outbox   *outbox.Outbox
 }
 
 // NewBot - конструктор бота
-func NewBot(cfg config.Config, ex exchange.Exchange, storage repo.Repo) *Bot {
+func NewBot(cfg config.Config, ex exchange.Exchange, orders repo.OrderStateRepo, lots repository.LotRepository, placer *takeprofit.Placer,
+	ob *outbox.Outbox) *Bot {
 	return &Bot{
 		config:   cfg,
 		exchange: ex,
-		storage:  storage,
+		orders:   orders,
+		lots:     lots,
+		placer:   placer,
+		outbox:   ob,
 	}
 }
 
@@ -60,109 +72,134 @@ func (b *Bot) Process(ctx context.Context) error {
 		return err
 	}
 
+	// Закрываем в журнале лоты по исполненным продажам, которые пропустил лиснер
+	for _, order := range allOrders {
+		if order.Side == exchange.Sell && order.Status == exchange.Filled {
+			b.closeLots(ctx, order)
+		}
+	}
+
 	for _, order := range allOrders {
 		orderAge := time.Now().Sub(time.UnixMilli(order.Time))
 		updateTime := time.Now().Sub(time.UnixMilli(order.UpdateTime))
 		// Процесим ордера, которые незапроцессились лиснером
-		if b.storage.Has(order.OrderID) && order.Status == exchange.Filled && updateTime > 15*time.Second {
-			newPrice, err := strconv.ParseFloat(order.Price, 64)
+		state, tracked := b.orders.Get(order.OrderID)
+		unsold := tracked && (state == repo.OrderNew || state == repo.OrderPartial || state == repo.OrderFilled)
+		// FILLED с ордером, который уже не стоит на бирже - частично исполненная покупка,
+		// отменённая этим воркером, продажу которой не удалось разместить сразу
+		finished := order.Status == exchange.Filled ||
+			state == repo.OrderFilled && order.Status != exchange.New && order.Status != exchange.PartiallyFilled
+		if unsold && finished && updateTime > 15*time.Second {
+			buyPrice, err := strconv.ParseFloat(order.Price, 64)
 			if err != nil {
 				return err
 			}
-			newPrice = newPrice * (1 + b.config.ProfitPercent/100)
 			qty, err := strconv.ParseFloat(order.ExecutedQty, 64)
 			if err != nil {
 				return err
 			}
-			sellOrder := exchange.SpotOrderRequest{
-				Symbol:   b.config.Symbol,
-				Side:     exchange.Sell,
-				Type:     exchange.Limit,
-				Quantity: qty,
-				Price:    newPrice,
-			}
 
-			// Проверяем, что есть достаточно KAS
-			if kasFreeBalance < qty {
+			// Проверяем, что есть достаточно KAS (частичные исполнения могли уже уйти в продажу)
+			if !b.enoughKas(ctx, order.OrderID, qty, kasFreeBalance) {
 				log.Printf("Недостаточно KAS для продажи, пропускаем ордер: %s (статус: %s, возраст: %s)", order.OrderID, order.Status, orderAge)
 				continue
 			}
 
-			orderResp, err := b.exchange.PlaceOrder(ctx, sellOrder)
+			orderResp, err := b.placer.SellFilled(ctx, order.OrderID, buyPrice, qty)
 			if err != nil {
 				log.Printf("Ошибка размещения ордера на продажу из воркера: %v", err)
 				return err
 			}
-			log.Printf("Ордер на продажу из воркера размещен: %s OldPrice=%s NewPrice=%s", orderResp.OrderID, order.Price, orderResp.Price)
-			// Удаляем ордер из стораджа
-			b.storage.Remove(order.OrderID)
+			if orderResp != nil {
+				log.Printf("Ордер на продажу из воркера размещен: %s OldPrice=%s NewPrice=%s", orderResp.OrderID, order.Price, orderResp.Price)
+			}
+		}
+
+		// Покупки лесенки стоят долго и перестраиваются ladder_v1
+		if b.config.Ladder.Enabled {
+			continue
 		}
 
 		// Отмена старых незаполненных ордеров
-		if b.storage.Has(order.OrderID) && (order.Status == exchange.New) {
+		if state == repo.OrderNew && order.Status == exchange.New {
 			if orderAge > 10*time.Minute {
-				err := b.exchange.CancelOrder(ctx, b.config.Symbol, order.OrderID)
+				err := b.outbox.CancelOrder(ctx, b.config.Symbol, order.OrderID)
 				if err != nil {
 					log.Printf("Ошибка отмены старого ордера %s: %v", order.OrderID, err)
 					return err
 				}
-				// Удаляем ордер из стораджа
-				b.storage.Remove(order.OrderID)
+				// Переход не пройдёт, если до отмены покупка успела исполниться - её продаст лиснер
+				if b.orders.Transition(order.OrderID, repo.OrderCanceled, repo.OrderNew) {
+					if err := b.lots.MarkBuyCanceled(ctx, order.OrderID); err != nil {
+						tools.LogErrorf("Ошибка записи отмены покупки %s в журнал: %v", order.OrderID, err)
+					}
+				}
 				log.Printf("Старый ордер отменён: %s (статус: %s, возраст: %s)", order.OrderID, order.Status, orderAge)
 			}
 		}
 
-		// Отмена старых частично заполненных ордеров
-		if b.storage.Has(order.OrderID) && order.Status == exchange.PartiallyFilled {
+		// Отмена старых частично заполненных ордеров: исполненная часть продаётся по цели тейк-профита
+		if tracked && (state == repo.OrderNew || state == repo.OrderPartial) && order.Status == exchange.PartiallyFilled {
 			if orderAge > 10*time.Minute {
-				// Проверяем, что сумма больше минимальной
 				qty, err := strconv.ParseFloat(order.ExecutedQty, 64)
 				if err != nil {
 					return err
 				}
-				newPrice, err := b.exchange.GetPrice(ctx, "KASUSDT")
+				buyPrice, err := strconv.ParseFloat(order.Price, 64)
 				if err != nil {
 					return err
 				}
 
 				// Проверяем, что сумма больше минимальной и есть достаточно KAS
-				if qty*newPrice < 1 {
+				if qty*buyPrice < exchange.MinNotional {
 					log.Printf("Сумма меньше минимальной, ордер не отменён: %s (статус: %s, возраст: %s)", order.OrderID, order.Status, orderAge)
 					continue
 				}
-				if kasFreeBalance < qty {
+				if !b.enoughKas(ctx, order.OrderID, qty, kasFreeBalance) {
 					log.Printf("Недостаточно KAS для продажи, пропускаем ордер: %s (статус: %s, возраст: %s)", order.OrderID, order.Status, orderAge)
 					continue
 				}
 
-				// сначала отменяем старый ордер
-				err = b.exchange.CancelOrder(ctx, b.config.Symbol, order.OrderID)
-				if err != nil {
-					log.Printf("Ошибка отмены старого ордера %s: %v", order.OrderID, err)
-					return err
+				// лиснер по PartiallyCanceled уже не начнёт продажу: её разместит CancelPartial
+				canceled, orderResp, err := b.placer.CancelPartial(ctx, order.OrderID, buyPrice)
+				if canceled {
+					log.Printf("Старый ордер отменён: %s (статус: %s, возраст: %s)", order.OrderID, order.Status, orderAge)
 				}
-				// затем создаем новый ордер на продажу на сумму заполненной части по текущей цене (тк она по идее выше цены старого ордера)
-				sellOrder := exchange.SpotOrderRequest{
-					Symbol:   b.config.Symbol,
-					Side:     exchange.Sell,
-					Type:     exchange.Limit,
-					Quantity: qty,
-					Price:    newPrice,
-				}
-				orderResp, err := b.exchange.PlaceOrder(ctx, sellOrder)
 				if err != nil {
+					log.Printf("Ошибка отмены старого ордера %s с продажей исполненного: %v", order.OrderID, err)
 					return err
 				}
-				log.Printf("Ордер на продажу от частичного: %s oldPrice: %s newPrice %.6f", orderResp.OrderID, order.Price, newPrice)
-				// Удаляем ордер из стораджа
-				b.storage.Remove(order.OrderID)
-				log.Printf("Старый ордер отменён: %s (статус: %s, возраст: %s)", order.OrderID, order.Status, orderAge)
+				if orderResp != nil {
+					log.Printf("Ордер на продажу от частичного: %s oldPrice: %s newPrice %s", orderResp.OrderID, order.Price, orderResp.Price)
+				}
 			}
 		}
 	}
 	return nil
 }
 
+// enoughKas - хватает ли свободного KAS на ещё не проданную часть исполнения покупки
+func (b *Bot) enoughKas(ctx context.Context, buyOrderID string, executedQty, kasFreeBalance float64) bool {
+	covered, err := b.lots.CoveredQty(ctx, buyOrderID)
+	if err != nil {
+		tools.LogErrorf("Ошибка чтения журнала по покупке %s: %v", buyOrderID, err)
+	}
+	return kasFreeBalance >= executedQty-covered
+}
+
+// closeLots - закрытие лотов журнала по исполненной продаже
+func (b *Bot) closeLots(ctx context.Context, order exchange.OrderInfo) {
+	price := exchange.FillPrice(order.Price, order.ExecutedQty, order.QuoteQty)
+	qty, err := strconv.ParseFloat(order.ExecutedQty, 64)
+	if err != nil {
+		return
+	}
+	err = b.placer.CloseSell(ctx, order.OrderID, price, qty)
+	if err != nil && !errors.Is(err, repository.ErrLotNotFound) {
+		tools.LogErrorf("Ошибка закрытия лота по продаже %s: %v", order.OrderID, err)
+	}
+}
+
 func GetCountOpenOrders(orders []exchange.OrderInfo) (int, int) {
 	buyCount := 0
 	sellCount := 0
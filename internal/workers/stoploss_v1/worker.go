@@ -0,0 +1,164 @@
+package stoploss_v1
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/logger"
+	"scalpingbot/internal/outbox"
+	"scalpingbot/internal/repo"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/takeprofit"
+	"scalpingbot/internal/tools"
+	"time"
+)
+
+// Bot - выход из позиций по стоп-лоссу и максимальному времени удержания
+type Bot struct {
+	config    config.Config
+	exchange  exchange.Exchange
+	positions repo.PositionRepo
+	lots      repository.LotRepository
+	outbox    *outbox.Outbox
+	placer    *takeprofit.Placer
+	logger    logger.Logger
+
+	// выходы по стопу за день считаются по журналу лотов, здесь только отметка об уведомлении
+	day         string
+	capNotified bool
+}
+
+// NewBot - конструктор бота
+func NewBot(cfg config.Config, ex exchange.Exchange, positions repo.PositionRepo, lots repository.LotRepository,
+	ob *outbox.Outbox, placer *takeprofit.Placer, logLogger logger.Logger) *Bot {
+	return &Bot{
+		config:    cfg,
+		exchange:  ex,
+		positions: positions,
+		lots:      lots,
+		outbox:    ob,
+		placer:    placer,
+		logger:    logLogger,
+	}
+}
+
+func (b *Bot) Process(ctx context.Context) error {
+	positions := b.positions.List()
+	if len(positions) == 0 {
+		return nil
+	}
+
+	if today := time.Now().Format(time.DateOnly); today != b.day {
+		b.day = today
+		b.capNotified = false
+	}
+
+	price, err := b.exchange.GetPrice(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+
+	maxHolding := time.Duration(b.config.StopLoss.MaxHoldingHours * float64(time.Hour))
+	for _, p := range positions {
+		var reason string
+		switch {
+		case b.config.StopLoss.Percent > 0 && price <= p.EntryPrice*(1-b.config.StopLoss.Percent/100):
+			reason = fmt.Sprintf("стоп-лосс %.2f%%", b.config.StopLoss.Percent)
+		case maxHolding > 0 && time.Since(p.OpenedAt) > maxHolding:
+			reason = fmt.Sprintf("время удержания больше %.1f ч", b.config.StopLoss.MaxHoldingHours)
+		default:
+			continue
+		}
+
+		if b.config.StopLoss.MaxDailyStopOuts > 0 {
+			stopOuts, profit, err := b.lots.StopOuts(ctx, tools.StartOfDay(time.Now()))
+			if err != nil {
+				return fmt.Errorf("ошибка подсчёта выходов по стопу за день: %w", err)
+			}
+			if stopOuts >= b.config.StopLoss.MaxDailyStopOuts {
+				if !b.capNotified {
+					b.capNotified = true
+					b.logger.Notify(fmt.Sprintf("Достигнут дневной лимит выходов по стопу: %d, результат %.4f USDT. Позиции удерживаются до завтра",
+						stopOuts, profit))
+				}
+				return nil
+			}
+		}
+
+		if err := b.exit(ctx, p, price, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exit - снимает тейк-профит и продаёт позицию по рынку или лимитом со смещением.
+// Если выход не разместился, тейк-профит возвращается по прежней цене и стоп повторит выход
+func (b *Bot) exit(ctx context.Context, p repo.Position, price float64, reason string) error {
+	if err := b.outbox.CancelOrder(ctx, b.config.Symbol, p.SellOrderID); err != nil {
+		// скорее всего тейк-профит уже исполнен
+		log.Printf("Ошибка отмены тейк-профита %s, позиция снята с контроля стопа: %v", p.SellOrderID, err)
+		b.positions.Remove(p.SellOrderID)
+		return nil
+	}
+	// тейк-профит мог успеть исполниться частично: продаём только остаток
+	qty, err := b.placer.SettleCanceled(ctx, p.SellOrderID, p.Qty)
+	if err != nil {
+		return b.restore(ctx, p, p.Qty, reason, err)
+	}
+	if qty == 0 {
+		b.positions.Remove(p.SellOrderID)
+		return nil
+	}
+
+	sellOrder := exchange.SpotOrderRequest{
+		Symbol:   b.config.Symbol,
+		Side:     exchange.Sell,
+		Type:     exchange.Market,
+		Quantity: qty,
+	}
+	exitPrice := price
+	if b.config.StopLoss.ExitMode == "limit" {
+		exitPrice = price * (1 - b.config.StopLoss.ExitOffsetPercent/100)
+		sellOrder.Type = exchange.Limit
+		sellOrder.Price = exitPrice
+	}
+	// если ответ не дошёл, при запуске Replayer перенесёт лоты на продажу или вернёт их в FILLED
+	intentID, orderResp, err := b.outbox.ReplaceSell(ctx, p.SellOrderID, sellOrder)
+	if err != nil {
+		return b.restore(ctx, p, qty, reason, err)
+	}
+	b.positions.Remove(p.SellOrderID)
+	if err := b.lots.ReplaceSellOrder(ctx, p.SellOrderID, orderResp.OrderID, exitPrice); err != nil {
+		log.Printf("Ошибка записи выхода %s в журнал: %v", orderResp.OrderID, err)
+	} else {
+		b.outbox.Done(ctx, intentID, orderResp.OrderID)
+		// выход принят биржей: он попадает в дневной лимит выходов по стопу
+		if err := b.lots.MarkStopOut(ctx, orderResp.OrderID); err != nil {
+			log.Printf("Ошибка отметки выхода по стопу %s в журнале: %v", orderResp.OrderID, err)
+		}
+	}
+
+	loss := (exitPrice - p.EntryPrice) * qty
+	b.logger.Notify(fmt.Sprintf("Выход из позиции (%s): buy=%s sell=%s вход=%.8f выход=%.8f объём=%.8f результат=%.4f USDT",
+		reason, p.BuyOrderID, orderResp.OrderID, p.EntryPrice, exitPrice, qty, loss))
+	return nil
+}
+
+// restore - выход не удался после снятия тейк-профита: тейк-профит возвращается по прежней цене
+// на оставшийся объём, позиция остаётся под контролем стопа, только если он вернулся
+func (b *Bot) restore(ctx context.Context, p repo.Position, qty float64, reason string, cause error) error {
+	if _, err := b.placer.RestoreSell(ctx, p.SellOrderID, qty, p.SellPrice); err != nil {
+		b.logger.Error(fmt.Sprintf("Ошибка выхода из позиции %s (%s), тейк-профит снят: %v; возврат по прежней цене: %v",
+			p.BuyOrderID, reason, cause, err))
+		return cause
+	}
+	b.logger.Error(fmt.Sprintf("Ошибка выхода из позиции %s (%s), тейк-профит возвращён: %v", p.BuyOrderID, reason, cause))
+	return cause
+}
+
+func (b *Bot) Name() string {
+	return "stoploss_v1"
+}
@@ -0,0 +1,174 @@
+package trailing_v1
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"scalpingbot/internal/config"
+	"scalpingbot/internal/exchange"
+	"scalpingbot/internal/logger"
+	"scalpingbot/internal/outbox"
+	"scalpingbot/internal/repo"
+	"scalpingbot/internal/repository"
+	"scalpingbot/internal/takeprofit"
+	"time"
+)
+
+// cleanupInterval - как часто убирать позиции, чьи продажи уже исполнились
+const cleanupInterval = time.Minute
+
+// Bot - трейлинг тейк-профита: после достижения цели следит за максимумом
+// и продаёт, когда цена откатывает на callback_percent
+type Bot struct {
+	config      config.Config
+	exchange    exchange.Exchange
+	positions   repo.PositionRepo
+	lots        repository.LotRepository
+	outbox      *outbox.Outbox
+	placer      *takeprofit.Placer
+	logger      logger.Logger
+	lastCleanup time.Time
+}
+
+// NewBot - конструктор бота
+func NewBot(cfg config.Config, ex exchange.Exchange, positions repo.PositionRepo, lots repository.LotRepository,
+	ob *outbox.Outbox, placer *takeprofit.Placer, logLogger logger.Logger) *Bot {
+	return &Bot{
+		config:    cfg,
+		exchange:  ex,
+		positions: positions,
+		lots:      lots,
+		outbox:    ob,
+		placer:    placer,
+		logger:    logLogger,
+	}
+}
+
+func (b *Bot) Process(ctx context.Context) error {
+	if time.Since(b.lastCleanup) > cleanupInterval {
+		if err := b.cleanup(ctx); err != nil {
+			return err
+		}
+		b.lastCleanup = time.Now()
+	}
+
+	price, err := b.exchange.GetPrice(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range b.positions.List() {
+		if !p.Trailing {
+			continue
+		}
+
+		if !p.Activated {
+			if price < p.TargetPrice {
+				continue
+			}
+			p.Activated = true
+			p.High = price
+			b.positions.Update(p)
+			log.Printf("Трейлинг активирован: buy=%s цель=%.8f цена=%.8f", p.BuyOrderID, p.TargetPrice, price)
+			continue
+		}
+
+		if price > p.High {
+			p.High = price
+			b.positions.Update(p)
+			continue
+		}
+
+		stop := p.High * (1 - b.config.Trailing.CallbackPercent/100)
+		if price > stop {
+			continue
+		}
+		if err := b.exit(ctx, p, price); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exit - снимает защитный ордер и продаёт по текущей цене, но не ниже цели.
+// Если продажа не разместилась, защитный ордер возвращается и трейлинг повторит выход
+func (b *Bot) exit(ctx context.Context, p repo.Position, price float64) error {
+	if err := b.outbox.CancelOrder(ctx, b.config.Symbol, p.SellOrderID); err != nil {
+		// скорее всего защитный ордер уже исполнен
+		log.Printf("Ошибка отмены защитного ордера %s, позиция снята с трейлинга: %v", p.SellOrderID, err)
+		b.positions.Remove(p.SellOrderID)
+		return nil
+	}
+	// защитный ордер мог успеть исполниться частично: продаём только остаток
+	qty, err := b.placer.SettleCanceled(ctx, p.SellOrderID, p.Qty)
+	if err != nil {
+		return b.restore(ctx, p, p.Qty, err)
+	}
+	if qty == 0 {
+		b.positions.Remove(p.SellOrderID)
+		return nil
+	}
+
+	sellPrice := price
+	if sellPrice < p.TargetPrice {
+		sellPrice = p.TargetPrice
+	}
+	sellOrder := exchange.SpotOrderRequest{
+		Symbol:   b.config.Symbol,
+		Side:     exchange.Sell,
+		Type:     exchange.Limit,
+		Quantity: qty,
+		Price:    sellPrice,
+	}
+	// если ответ не дошёл, при запуске Replayer перенесёт лоты на продажу или вернёт их в FILLED
+	intentID, orderResp, err := b.outbox.ReplaceSell(ctx, p.SellOrderID, sellOrder)
+	if err != nil {
+		return b.restore(ctx, p, qty, err)
+	}
+	b.positions.Remove(p.SellOrderID)
+	if err := b.lots.ReplaceSellOrder(ctx, p.SellOrderID, orderResp.OrderID, sellPrice); err != nil {
+		log.Printf("Ошибка записи трейлинг продажи %s в журнал: %v", orderResp.OrderID, err)
+	} else {
+		b.outbox.Done(ctx, intentID, orderResp.OrderID)
+	}
+	log.Printf("Трейлинг продажа размещена: %s buy=%s максимум=%.8f цена=%s", orderResp.OrderID, p.BuyOrderID, p.High, orderResp.Price)
+	return nil
+}
+
+// restore - трейлинг продажа не удалась после снятия защитного ордера: он возвращается по прежней
+// цене на оставшийся объём, позиция остаётся на трейлинге, только если он вернулся
+func (b *Bot) restore(ctx context.Context, p repo.Position, qty float64, cause error) error {
+	if _, err := b.placer.RestoreSell(ctx, p.SellOrderID, qty, p.SellPrice); err != nil {
+		b.logger.Error(fmt.Sprintf("Ошибка трейлинг продажи для %s, защитный ордер снят: %v; возврат по прежней цене: %v",
+			p.BuyOrderID, cause, err))
+		return cause
+	}
+	b.logger.Error(fmt.Sprintf("Ошибка трейлинг продажи для %s, защитный ордер возвращён: %v", p.BuyOrderID, cause))
+	return cause
+}
+
+// cleanup - убирает позиции, чьи ордера на продажу больше не стоят на бирже
+func (b *Bot) cleanup(ctx context.Context) error {
+	positions := b.positions.List()
+	if len(positions) == 0 {
+		return nil
+	}
+	openOrders, err := b.exchange.GetOpenOrders(ctx, b.config.Symbol)
+	if err != nil {
+		return err
+	}
+	open := make(map[string]struct{}, len(openOrders))
+	for _, order := range openOrders {
+		open[order.OrderID] = struct{}{}
+	}
+	for _, p := range positions {
+		if _, ok := open[p.SellOrderID]; !ok {
+			b.positions.Remove(p.SellOrderID)
+		}
+	}
+	return nil
+}
+
+func (b *Bot) Name() string {
+	return "trailing_v1"
+}
@@ -9,4 +9,44 @@ CREATE TABLE IF NOT EXISTS users
     secret_key       TEXT,
     symbol           TEXT,
     created_at       TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-)
\ No newline at end of file
+);
+
+CREATE TABLE IF NOT EXISTS grid_state
+(
+    id           INTEGER PRIMARY KEY CHECK (id = 1),
+    symbol       TEXT,
+    lower_price  REAL,
+    upper_price  REAL,
+    levels       INTEGER,
+    config_lower REAL,
+    config_upper REAL,
+    updated_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS grid_levels
+(
+    level    INTEGER PRIMARY KEY,
+    price    REAL,
+    side     TEXT,
+    order_id TEXT
+)
+;
+
+CREATE TABLE IF NOT EXISTS lots
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol        TEXT,
+    buy_order_id  TEXT,
+    buy_price     REAL,
+    buy_qty       REAL,
+    buy_fee       REAL DEFAULT 0,
+    sell_order_id TEXT DEFAULT '',
+    sell_price    REAL DEFAULT 0,
+    sell_qty      REAL DEFAULT 0,
+    sell_fee      REAL DEFAULT 0,
+    state         TEXT,
+    profit        REAL DEFAULT 0,
+    created_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    closed_at     TIMESTAMP
+)